@@ -0,0 +1,61 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Multi is an Action that performs multiple actions. Each action can be gated
+// by a Matcher, in which case it is only performed when at least one of the
+// messages matches.
+type Multi []MultiAction
+
+// MultiAction is a single action of Multi.
+type MultiAction struct {
+	Matcher types.Matcher // Matcher is optional.
+	Action  types.Action  // Action is required.
+}
+
+// Assert that Multi implements types.Action.
+var _ types.Action = Multi{}
+
+// matches returns true when any of the messages matches.
+func (a MultiAction) matches(messages []types.Message) bool {
+	if a.Matcher == nil {
+		return true
+	}
+
+	for _, message := range messages {
+		if a.Matcher.MatchMessage(message) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PerformAction implements types.Action. All matching actions are performed,
+// even if some of them fail.
+func (a Multi) PerformAction(ctx context.Context, messages []types.Message) error {
+	var errs []string
+
+	for _, ma := range a {
+		if !ma.matches(messages) {
+			continue
+		}
+
+		if err := ma.Action.PerformAction(ctx, messages); err != nil {
+			errs = append(errs, fmt.Sprintf("%+v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("actions failed: \n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package action
+
+import (
+	"context"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// DefaultRetryBackoff is the default RetryParams.Backoff.
+const DefaultRetryBackoff = time.Second
+
+// Retry is an Action that performs an Action again when it fails, with an
+// exponential backoff, until it succeeds or Attempts have been made. Since
+// the processor waits for the action, the total backoff should be shorter
+// than the health stall timeout.
+type Retry struct {
+	params RetryParams
+}
+
+// RetryParams contains parameters for NewRetry.
+type RetryParams struct {
+	Logger   log.Logger   // Logger to log the failed attempts with.
+	Action   types.Action // Action to perform.
+	Attempts int          // Attempts is the maximum number of attempts, including the first one.
+	// Backoff is the delay before the first retry, which is doubled for
+	// every following one. Defaults to DefaultRetryBackoff.
+	Backoff time.Duration
+	// OnRetry, when set, is called before every retry, e.g. to record it.
+	OnRetry func()
+}
+
+// NewRetry creates a new instance of Retry.
+func NewRetry(params RetryParams) *Retry {
+	params.Logger = params.Logger.WithNamespaceAppended("action_retry")
+
+	if params.Backoff <= 0 {
+		params.Backoff = DefaultRetryBackoff
+	}
+
+	return &Retry{
+		params: params,
+	}
+}
+
+// Assert that Retry implements types.Action.
+var _ types.Action = &Retry{}
+
+// PerformAction implements types.Action. It returns the error of the last
+// attempt, also when ctx is done while waiting to retry.
+func (a *Retry) PerformAction(ctx context.Context, messages []types.Message) error {
+	backoff := a.params.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := a.params.Action.PerformAction(ctx, messages)
+		if err == nil || attempt >= a.params.Attempts {
+			return errors.Trace(err)
+		}
+
+		a.params.Logger.Error("Action failed, retrying", err, log.Ctx{
+			"attempt": attempt,
+			"backoff": backoff.String(),
+		})
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return errors.Trace(err)
+		}
+
+		backoff *= 2
+
+		if a.params.OnRetry != nil {
+			a.params.OnRetry()
+		}
+	}
+}
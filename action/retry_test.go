@@ -0,0 +1,78 @@
+package action_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/action"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyAction is an Action that fails the first failures times.
+type flakyAction struct {
+	failures int
+	calls    int
+}
+
+func (a *flakyAction) PerformAction(ctx context.Context, messages []types.Message) error {
+	a.calls++
+
+	if a.calls <= a.failures {
+		return errors.New("test")
+	}
+
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	newRetry := func(a types.Action, backoff time.Duration, retries *int) *action.Retry {
+		return action.NewRetry(action.RetryParams{
+			Logger:   log.New(),
+			Action:   a,
+			Attempts: 3,
+			Backoff:  backoff,
+			OnRetry: func() {
+				*retries++
+			},
+		})
+	}
+
+	t.Run("succeeds", func(t *testing.T) {
+		var retries int
+
+		a := &flakyAction{failures: 2}
+
+		assert.NoError(t, newRetry(a, time.Millisecond, &retries).PerformAction(ctx, nil))
+		assert.Equal(t, 3, a.calls)
+		assert.Equal(t, 2, retries)
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		var retries int
+
+		a := &flakyAction{failures: 3}
+
+		assert.Error(t, newRetry(a, time.Millisecond, &retries).PerformAction(ctx, nil))
+		assert.Equal(t, 3, a.calls)
+		assert.Equal(t, 2, retries)
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		var retries int
+
+		a := &flakyAction{failures: 3}
+
+		assert.Error(t, newRetry(a, time.Hour, &retries).PerformAction(ctx, nil))
+		assert.Equal(t, 1, a.calls)
+		assert.Equal(t, 0, retries)
+	})
+}
@@ -0,0 +1,38 @@
+package clock
+
+import (
+	"time"
+
+	"github.com/jeremija/taily/types"
+)
+
+// Real is a types.Clock that uses the system time.
+type Real struct{}
+
+// Assert that Real implements types.Clock.
+var _ types.Clock = Real{}
+
+// New creates a new instance of Real.
+func New() Real {
+	return Real{}
+}
+
+// Now implements types.Clock.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker implements types.Clock.
+func (Real) NewTicker(d time.Duration) types.Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// realTicker implements types.Ticker with time.Ticker.
+type realTicker struct {
+	*time.Ticker
+}
+
+// C implements types.Ticker.
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
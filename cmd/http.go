@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// startHTTP listens on addr and serves handler in a separate goroutine until
+// ctx is done.
+func startHTTP(ctx context.Context, logger log.Logger, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Annotatef(err, "listen %q", addr)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Listening", log.Ctx{
+		"addr": listener.Addr().String(),
+	})
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !types.IsError(err, http.ErrServerClosed) {
+			logger.Error("Failed to serve HTTP", err, nil)
+		}
+	}()
+
+	return nil
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
-	"github.com/jeremija/taily/config"
 	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/metrics"
+	"github.com/jeremija/taily/reloader"
 	"github.com/jeremija/taily/types"
 	"github.com/juju/errors"
 	"github.com/peer-calls/log"
@@ -28,13 +32,40 @@ func main2(argv []string) error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGPIPE)
 	defer cancel()
 
+	if len(argv) > 1 && argv[1] == "migrate" {
+		return errors.Trace(migrate(ctx, argv[2:]))
+	}
+
+	if len(argv) > 1 && argv[1] == "state" {
+		return errors.Trace(state(ctx, argv[2:]))
+	}
+
+	if len(argv) > 1 && argv[1] == "validate" {
+		return errors.Trace(validate(argv[2:]))
+	}
+
+	if len(argv) > 1 && argv[1] == "test" {
+		return errors.Trace(test(ctx, argv[2:]))
+	}
+
+	if len(argv) > 1 && argv[1] == "query" {
+		return errors.Trace(query(ctx, argv[2:]))
+	}
+
+	if len(argv) > 1 && argv[1] == "tail" {
+		return errors.Trace(tail(ctx, argv[2:]))
+	}
+
 	fs := pflag.NewFlagSet("taily", pflag.ExitOnError)
 
 	var args struct {
-		config string
+		config         string
+		reloadInterval time.Duration
 	}
 
 	fs.StringVarP(&args.config, "config", "c", "", "config file to use")
+	fs.DurationVar(&args.reloadInterval, "reload-interval", 5*time.Second,
+		"interval to check the config file for changes, 0 to only reload on SIGHUP")
 
 	if err := fs.Parse(argv); err != nil {
 		return errors.Trace(err)
@@ -51,55 +82,74 @@ func main2(argv []string) error {
 		"version": GitDescribe,
 	})
 
-	var cfg config.Config
-
-	if args.config != "" {
-		if err := cfg.FromYAMLFile(args.config); err != nil {
-			return errors.Trace(err)
-		}
-	}
-
-	if err := cfg.FromYAMLEnv("TALY.CONFIG"); err != nil {
+	cfg, err := loadConfig(args.config)
+	if err != nil {
 		return errors.Trace(err)
 	}
 
 	go func() {
 		<-ctx.Done()
 
-		logger.Info("Tearing down", nil)
+		// Restore the default signal behaviour so that a second signal
+		// terminates the process without waiting for the grace period.
+		cancel()
+
+		logger.Info("Tearing down, send the signal again to force exit", log.Ctx{
+			"grace": factory.NewShutdownGrace(cfg.Shutdown).String(),
+		})
 	}()
 
-	pipelines, err := factory.NewPipelines(logger, &cfg)
+	persister, err := factory.NewPersister(cfg.Persister)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	errCh := make(chan error, len(pipelines))
+	if closer, ok := persister.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	sup := factory.NewSupervisor(logger, cfg.Supervisor)
+
+	checker := factory.NewHealthChecker(sup, cfg.Health)
 
-	for i := range pipelines {
-		pipeline := pipelines[i]
+	var m *metrics.Metrics
 
-		go func() {
-			errCh <- errors.Trace(pipeline.ProcessPipeline(ctx))
-		}()
+	if cfg.HTTP.Listen != "" {
+		m = metrics.New(metrics.Params{
+			Supervisor: sup,
+		})
 	}
 
-	numErrors := 0
+	r := reloader.New(reloader.Params{
+		Logger:     logger,
+		Supervisor: sup,
+		Persister:  persister,
+		Metrics:    m,
+	})
 
-	for i := 0; i < cap(errCh); i++ {
-		if err := <-errCh; err != nil {
-			if types.IsError(err, context.Canceled) {
-				logger.Info("Watcher complete", nil)
-			} else {
-				numErrors++
-				logger.Error("Watcher failed", err, nil)
-			}
+	if _, err := r.Reload(cfg); err != nil {
+		return errors.Trace(err)
+	}
+
+	if cfg.HTTP.Listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		mux.Handle("/healthz", checker.LiveHandler())
+		mux.Handle("/readyz", checker.ReadyHandler())
+
+		if err := startHTTP(ctx, logger, cfg.HTTP.Listen, mux); err != nil {
+			return errors.Trace(err)
 		}
 	}
 
-	if numErrors > 0 {
-		return errors.Errorf("there were errors: %d", numErrors)
+	go reload(ctx, logger, r, args.config, args.reloadInterval)
+	go notifySystemd(ctx, logger, checker)
+
+	if err := sup.Run(ctx); err != nil && !types.IsError(err, context.Canceled) {
+		return errors.Trace(err)
 	}
 
+	logger.Info("Watchers complete", nil)
+
 	return nil
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jeremija/taily/persister"
+	"github.com/juju/errors"
+	"github.com/spf13/pflag"
+)
+
+// migrate copies the state stored by the file persister to a bolt database.
+func migrate(ctx context.Context, argv []string) error {
+	fs := pflag.NewFlagSet("taily migrate", pflag.ExitOnError)
+
+	var args struct {
+		from    string
+		to      string
+		history int
+	}
+
+	fs.StringVar(&args.from, "from", "", "file persister directory to migrate from")
+	fs.StringVar(&args.to, "to", "", "bolt database file to migrate to")
+	fs.IntVar(&args.history, "history", persister.DefaultBoltHistory, "number of states to keep per reader")
+
+	if err := fs.Parse(argv); err != nil {
+		return errors.Trace(err)
+	}
+
+	if args.from == "" || args.to == "" {
+		return errors.Errorf("both --from and --to are required")
+	}
+
+	src := persister.NewFile(args.from)
+
+	// Make sure taily is not using the state while it is being copied.
+	if err := src.Lock(); err != nil {
+		return errors.Trace(err)
+	}
+
+	defer src.Close()
+
+	dst, err := persister.NewBolt(persister.BoltParams{
+		Path:    args.to,
+		History: args.history,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	defer dst.Close()
+
+	stats, err := persister.MigrateFile(ctx, src, dst)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	fmt.Printf("Migrated %d states and %d data entries from %s to %s\n",
+		stats.States, stats.Data, args.from, args.to)
+
+	return nil
+}
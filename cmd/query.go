@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/spf13/pflag"
+)
+
+// query runs the configured readers over the logs between --since and
+// --until, without touching the persisted state, and prints the actions that
+// would have been performed.
+func query(ctx context.Context, argv []string) error {
+	fs := pflag.NewFlagSet("taily query", pflag.ExitOnError)
+
+	var args struct {
+		config  string
+		since   string
+		until   string
+		readers []string
+	}
+
+	fs.StringVarP(&args.config, "config", "c", "", "config file to use")
+	fs.StringVar(&args.since, "since", "", "start of the time range, RFC3339 or a duration ago, e.g. 24h")
+	fs.StringVar(&args.until, "until", "", "end of the time range, RFC3339 or a duration ago, defaults to now")
+	fs.StringSliceVar(&args.readers, "reader", nil, "IDs of the readers to run, defaults to all")
+
+	if err := fs.Parse(argv); err != nil {
+		return errors.Trace(err)
+	}
+
+	if args.config == "" || args.since == "" {
+		return errors.Errorf("--config and --since are required")
+	}
+
+	now := time.Now()
+
+	since, err := parseQueryTime(args.since, now)
+	if err != nil {
+		return errors.Annotate(err, "parse --since")
+	}
+
+	until := now
+
+	if args.until != "" {
+		until, err = parseQueryTime(args.until, now)
+		if err != nil {
+			return errors.Annotate(err, "parse --until")
+		}
+	}
+
+	if !until.After(since) {
+		return errors.Errorf("--until must be after --since")
+	}
+
+	var cfg config.Config
+
+	if err := cfg.FromYAMLFile(args.config); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := filterReaders(&cfg, args.readers); err != nil {
+		return errors.Trace(err)
+	}
+
+	logger := log.New().
+		WithConfig(log.NewConfig(log.ConfigMap{
+			"**": log.LevelWarn,
+		})).
+		WithConfig(log.NewConfigFromString(os.Getenv("TAILY_LOG"))).
+		WithNamespace("taily")
+
+	printer := &queryPrinter{
+		w:      os.Stdout,
+		counts: map[string]int{},
+	}
+
+	actionsMap := make(map[string]types.Action, len(cfg.Actions))
+
+	for name := range cfg.Actions {
+		actionsMap[name] = &queryAction{
+			name:    name,
+			printer: printer,
+		}
+	}
+
+	pipelines, err := factory.NewHistoryPipelines(logger, &cfg, actionsMap, since, until)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	errCh := make(chan error, len(pipelines))
+
+	for _, pline := range pipelines {
+		pline := pline
+
+		go func() {
+			errCh <- errors.Annotatef(pline.ProcessPipeline(ctx), "reader %q", pline.ReaderID())
+		}()
+	}
+
+	var retErr error
+
+	for range pipelines {
+		if err := <-errCh; err != nil && retErr == nil {
+			retErr = errors.Trace(err)
+		}
+	}
+
+	printer.summary()
+
+	return retErr
+}
+
+// parseQueryTime parses value as an RFC3339 timestamp, or as a duration
+// before now.
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			d = -d
+		}
+
+		return now.Add(-d), nil
+	}
+
+	ts, err := time.Parse(time.RFC3339, value)
+
+	return ts, errors.Trace(err)
+}
+
+// filterReaders removes the readers whose IDs are not in readerIDs from cfg.
+// All readers are kept when readerIDs is empty.
+func filterReaders(cfg *config.Config, readerIDs []string) error {
+	if len(readerIDs) == 0 {
+		return nil
+	}
+
+	readers := make([]config.Reader, 0, len(readerIDs))
+
+	for _, readerID := range readerIDs {
+		var found bool
+
+		for _, readerConfig := range cfg.Readers {
+			if readerConfig.ReaderID() == types.ReaderID(readerID) {
+				readers = append(readers, readerConfig)
+				found = true
+			}
+		}
+
+		if !found {
+			return errors.NotFoundf("reader %q", readerID)
+		}
+	}
+
+	cfg.Readers = readers
+
+	return nil
+}
+
+// queryPrinter prints the actions that would have been performed.
+type queryPrinter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	counts map[string]int // counts contains the number of calls per action.
+}
+
+// print prints a single action call.
+func (p *queryPrinter) print(name string, messages []types.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.counts[name]++
+
+	if len(messages) == 0 {
+		fmt.Fprintf(p.w, "%s: no messages\n", name)
+
+		return
+	}
+
+	first := messages[0]
+
+	texts := make([]string, len(messages))
+
+	for i := range messages {
+		texts[i] = messages[i].Text()
+	}
+
+	fmt.Fprintf(p.w, "%s %s (%s):\n  %s\n",
+		first.Timestamp.Format(time.RFC3339), name, first.ReaderID, strings.Join(texts, "\n  "))
+}
+
+// summary prints the number of calls per action.
+func (p *queryPrinter) summary() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.counts))
+
+	for name := range p.counts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintln(p.w, "Summary:")
+
+	if len(names) == 0 {
+		fmt.Fprintln(p.w, "  no actions would have been performed")
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(p.w, "  %s: %d\n", name, p.counts[name])
+	}
+}
+
+// queryAction is a types.Action that prints the call instead of performing
+// the action.
+type queryAction struct {
+	name    string
+	printer *queryPrinter
+}
+
+// PerformAction implements types.Action.
+func (a *queryAction) PerformAction(ctx context.Context, messages []types.Message) error {
+	a.printer.print(a.name, messages)
+
+	return nil
+}
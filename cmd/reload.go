@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/reloader"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// loadConfig reads the config from configFile, if set, and from the
+// environment.
+func loadConfig(configFile string) (*config.Config, error) {
+	var cfg config.Config
+
+	if configFile != "" {
+		if err := cfg.FromYAMLFile(configFile); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	if err := cfg.FromYAMLEnv("TALY.CONFIG"); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &cfg, nil
+}
+
+// configVersion identifies the version of the config file by its
+// modification time and size.
+type configVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// statConfig returns the configVersion of configFile.
+func statConfig(configFile string) (configVersion, error) {
+	fi, err := os.Stat(configFile)
+	if err != nil {
+		return configVersion{}, errors.Trace(err)
+	}
+
+	return configVersion{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+	}, nil
+}
+
+// reload reloads the config on SIGHUP, and when configFile changes if
+// interval is positive, until ctx is done. A config that fails to load is
+// logged and the current one is kept.
+func reload(ctx context.Context, logger log.Logger, r *reloader.Reloader, configFile string, interval time.Duration) {
+	hupCh := make(chan os.Signal, 1)
+
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	var (
+		version configVersion
+		pollCh  <-chan time.Time
+	)
+
+	if configFile != "" && interval > 0 {
+		// Errors are reported upon reload.
+		version, _ = statConfig(configFile)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		pollCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-hupCh:
+			logger.Info("Received SIGHUP, reloading config", nil)
+		case <-pollCh:
+			v, err := statConfig(configFile)
+			if err != nil || v == version {
+				continue
+			}
+
+			version = v
+
+			logger.Info("Config file changed, reloading config", nil)
+		case <-ctx.Done():
+			return
+		}
+
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			logger.Error("Failed to load config, keeping the current one", err, nil)
+
+			continue
+		}
+
+		if _, err := r.Reload(cfg); err != nil {
+			logger.Error("Failed to reload config, keeping the current one", err, nil)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/spf13/pflag"
+)
+
+// state lists or rolls back the checkpoints of a reader kept by the bolt
+// persister. taily must not be running, since it holds the database lock.
+func state(ctx context.Context, argv []string) error {
+	if len(argv) == 0 {
+		return errors.Errorf("usage: taily state history|rollback [flags]")
+	}
+
+	command := argv[0]
+
+	switch command {
+	case "history", "rollback":
+	default:
+		return errors.Errorf("unknown state command: %q", command)
+	}
+
+	fs := pflag.NewFlagSet("taily state "+command, pflag.ExitOnError)
+
+	var args struct {
+		config string
+		db     string
+		reader string
+		steps  int
+	}
+
+	fs.StringVarP(&args.config, "config", "c", "", "config file with the bolt persister to use")
+	fs.StringVar(&args.db, "db", "", "bolt database file, overrides the config")
+	fs.StringVar(&args.reader, "reader", "", "ID of the reader")
+
+	if command == "rollback" {
+		fs.IntVar(&args.steps, "steps", 1, "number of checkpoints to roll back")
+	}
+
+	if err := fs.Parse(argv[1:]); err != nil {
+		return errors.Trace(err)
+	}
+
+	if args.reader == "" {
+		return errors.Errorf("--reader is required")
+	}
+
+	path, err := statePath(args.config, args.db)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	p, err := persister.NewBolt(persister.BoltParams{
+		Path: path,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	defer p.Close()
+
+	readerID := types.ReaderID(args.reader)
+
+	if command == "history" {
+		states, err := p.History(ctx, readerID)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		if len(states) == 0 {
+			return errors.NotFoundf("state of reader %q", readerID)
+		}
+
+		for i, s := range states {
+			printState(i, s)
+		}
+
+		return nil
+	}
+
+	if args.steps <= 0 {
+		return errors.Errorf("--steps must be positive")
+	}
+
+	s, removed, err := p.Rollback(ctx, readerID, args.steps)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if removed > 0 {
+		// The processor state contains the messages read after the
+		// checkpoint, which are read again, so restoring it would act on them
+		// twice.
+		if err := p.SaveData(ctx, pipeline.SnapshotKey(readerID), nil); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	fmt.Printf("Rolled back %q by %d checkpoints, the reader resumes from:\n", readerID, removed)
+	printState(0, s)
+
+	return nil
+}
+
+// statePath returns the database file from db, or from the bolt persister
+// in the config file.
+func statePath(configFile string, db string) (string, error) {
+	if db != "" {
+		return db, nil
+	}
+
+	if configFile == "" {
+		return "", errors.Errorf("--config or --db is required")
+	}
+
+	var cfg config.Config
+
+	if err := cfg.FromYAMLFile(configFile); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	if cfg.Persister.Type != "bolt" {
+		return "", errors.Errorf("state history requires the bolt persister, got: %q", cfg.Persister.Type)
+	}
+
+	return cfg.Persister.Bolt.Path, nil
+}
+
+// printState prints the checkpoint with index i, where 0 is the latest.
+func printState(i int, s types.State) {
+	if s.Timestamp.IsZero() {
+		fmt.Printf("%d: no state, the reader starts from its initial state\n", i)
+
+		return
+	}
+
+	fmt.Printf("%d: %s messages=%d", i, s.Timestamp.Format(time.RFC3339Nano), s.NumMessages)
+
+	if s.Cursor != "" {
+		fmt.Printf(" cursor=%s", s.Cursor)
+	}
+
+	fmt.Println()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/jeremija/taily/health"
+	"github.com/peer-calls/log"
+)
+
+// notifySystemd notifies systemd that taily is ready once all readers have
+// been started. When the watchdog is enabled (WatchdogSec), it is pinged
+// only while all readers are live, so that systemd restarts taily when a
+// reader gets stuck. It returns when ctx is done or when taily is not run by
+// systemd with Type=notify.
+func notifySystemd(ctx context.Context, logger log.Logger, checker *health.Checker) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+
+	logger = logger.WithNamespaceAppended("systemd")
+
+	notify := func(state string) {
+		if _, err := daemon.SdNotify(false, state); err != nil {
+			logger.Error("Failed to notify systemd", err, log.Ctx{
+				"state": state,
+			})
+		}
+	}
+
+	watchdog, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		logger.Error("Failed to read watchdog interval", err, nil)
+	}
+
+	interval := time.Second
+	if watchdog > 0 {
+		// Ping twice per interval as recommended by sd_watchdog_enabled(3).
+		interval = watchdog / 2
+
+		logger.Info("Watchdog enabled", log.Ctx{
+			"watchdog": watchdog.String(),
+		})
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ready := false
+
+	for {
+		report := checker.Check()
+
+		if !ready && report.Started {
+			notify(daemon.SdNotifyReady)
+
+			ready = true
+
+			if watchdog <= 0 {
+				break
+			}
+		}
+
+		if watchdog > 0 {
+			if report.Live {
+				notify(daemon.SdNotifyWatchdog)
+			} else {
+				logger.Warn("Readers are stuck, skipping watchdog ping", log.Ctx{
+					"readers": stuckReaders(report),
+				})
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			notify(daemon.SdNotifyStopping)
+
+			return
+		}
+	}
+
+	<-ctx.Done()
+
+	notify(daemon.SdNotifyStopping)
+}
+
+// stuckReaders returns the IDs of readers that are not live.
+func stuckReaders(report health.Report) []string {
+	var ret []string
+
+	for _, reader := range report.Readers {
+		if !reader.Live {
+			ret = append(ret, string(reader.ReaderID))
+		}
+	}
+
+	return ret
+}
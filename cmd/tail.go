@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/jeremija/taily/action"
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/formatter"
+	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/spf13/pflag"
+)
+
+// tail follows the logs of a configured reader and prints the messages
+// matching the expression, instead of running the configured processors.
+func tail(ctx context.Context, argv []string) error {
+	fs := pflag.NewFlagSet("taily tail", pflag.ExitOnError)
+
+	var args struct {
+		config   string
+		reader   string
+		expr     string
+		format   string
+		template string
+		color    string
+		since    string
+	}
+
+	fs.StringVarP(&args.config, "config", "c", "", "config file to use")
+	fs.StringVar(&args.reader, "reader", "", "ID of the reader to follow, optional when there is a single reader")
+	fs.StringVarP(&args.expr, "expr", "e", "", "matcher expression, e.g. (field \"PRIORITY\" \"^[0-3]$\"), defaults to all messages")
+	fs.StringVar(&args.format, "format", "plain", "output format: plain, json or template")
+	fs.StringVar(&args.template, "template", "{$timestamp} {MESSAGE}", "format of the template output")
+	fs.StringVar(&args.color, "color", "auto", "colorize the output: auto, always or never")
+	fs.StringVar(&args.since, "since", "", "start from an RFC3339 timestamp or a duration ago, defaults to now")
+
+	if err := fs.Parse(argv); err != nil {
+		return errors.Trace(err)
+	}
+
+	if args.config == "" {
+		return errors.Errorf("--config is required")
+	}
+
+	since := time.Now()
+
+	if args.since != "" {
+		var err error
+
+		since, err = parseQueryTime(args.since, since)
+		if err != nil {
+			return errors.Annotate(err, "parse --since")
+		}
+	}
+
+	f, err := newTailFormatter(args.format, args.template, args.color)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var m types.Matcher
+
+	if args.expr != "" {
+		m, err = matcher.Compile(args.expr)
+		if err != nil {
+			return errors.Annotate(err, "compile --expr")
+		}
+	}
+
+	var cfg config.Config
+
+	if err := cfg.FromYAMLFile(args.config); err != nil {
+		return errors.Trace(err)
+	}
+
+	readerConfig, err := cfg.FindReader(types.ReaderID(args.reader))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	logger := log.New().
+		WithConfig(log.NewConfig(log.ConfigMap{
+			"**": log.LevelWarn,
+		})).
+		WithConfig(log.NewConfigFromString(os.Getenv("TAILY_LOG"))).
+		WithNamespace("taily")
+
+	printAction := action.NewLog(f, os.Stdout)
+
+	newProcessor := func() (types.Processor, error) {
+		var proc types.Processor = processor.NewAny(printAction)
+
+		if m != nil {
+			proc = processor.NewWhen(m, proc)
+		}
+
+		if readerConfig.Type == "docker" {
+			proc = processor.NewWhen(containerLogs(readerConfig.ReaderID()), proc)
+		}
+
+		return proc, nil
+	}
+
+	pline, err := factory.NewTailPipeline(logger, &cfg, readerConfig, newProcessor, since)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = pline.ProcessPipeline(ctx)
+	if types.IsError(err, context.Canceled) {
+		return nil
+	}
+
+	return errors.Trace(err)
+}
+
+// containerLogs is a types.Matcher that matches the messages read from the
+// containers of the docker reader with the ID, and not the container start
+// and stop events sent by the reader itself.
+type containerLogs types.ReaderID
+
+// MatchMessage implements types.Matcher.
+func (m containerLogs) MatchMessage(message types.Message) bool {
+	return message.ReaderID != types.ReaderID(m)
+}
+
+// newTailFormatter creates the formatter for the tail output. The output is
+// colorized when color is always, or when it is auto and stdout is a
+// terminal.
+func newTailFormatter(format, template, color string) (types.Formatter, error) {
+	var f types.Formatter
+
+	switch format {
+	case "plain":
+		f = formatter.NewPlain()
+	case "json":
+		f = formatter.NewJSON()
+	case "template":
+		t, err := formatter.NewTemplate(template+"\n", formatter.WithQuotes(0, 0))
+		if err != nil {
+			return nil, errors.Annotate(err, "parse --template")
+		}
+
+		f = t
+	default:
+		return nil, errors.Errorf("unknown format: %q", format)
+	}
+
+	switch color {
+	case "always":
+		return formatter.NewColor(f), nil
+	case "auto":
+		if isTerminal(os.Stdout) {
+			return formatter.NewColor(f), nil
+		}
+
+		return f, nil
+	case "never":
+		return f, nil
+	default:
+		return nil, errors.Errorf("unknown color mode: %q", color)
+	}
+}
+
+// isTerminal returns true when file is a character device.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
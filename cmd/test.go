@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/ruletest"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/spf13/pflag"
+)
+
+// test runs the fixture messages through the processors of a reader with the
+// actions replaced by recorders, prints the actions performed and checks
+// them against the expectations.
+func test(ctx context.Context, argv []string) error {
+	fs := pflag.NewFlagSet("taily test", pflag.ExitOnError)
+
+	var args struct {
+		config     string
+		fixture    string
+		expect     string
+		reader     string
+		start      string
+		flushAfter time.Duration
+	}
+
+	fs.StringVarP(&args.config, "config", "c", "", "config file to use")
+	fs.StringVar(&args.fixture, "fixture", "", "file with messages, one per line as plain text or JSON")
+	fs.StringVar(&args.expect, "expect", "", "YAML file with the expected actions")
+	fs.StringVar(&args.reader, "reader", "", "ID of the reader to test, overrides the expectations")
+	fs.StringVar(&args.start, "start", "2000-01-01T00:00:00Z", "RFC3339 timestamp of messages without one")
+	fs.DurationVar(&args.flushAfter, "flush-after", ruletest.DefaultFlushAfter,
+		"time after the last message at which pending groups are flushed")
+
+	if err := fs.Parse(argv); err != nil {
+		return errors.Trace(err)
+	}
+
+	if args.config == "" || args.fixture == "" || args.expect == "" {
+		return errors.Errorf("--config, --fixture and --expect are required")
+	}
+
+	start, err := time.Parse(time.RFC3339, args.start)
+	if err != nil {
+		return errors.Annotate(err, "parse --start")
+	}
+
+	var cfg config.Config
+
+	if err := cfg.FromYAMLFile(args.config); err != nil {
+		return errors.Trace(err)
+	}
+
+	expectations, err := readExpectations(args.expect)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if args.reader != "" {
+		expectations.Reader = types.ReaderID(args.reader)
+	}
+
+	readerConfig, err := cfg.FindReader(expectations.Reader)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	f, err := os.Open(args.fixture)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	defer f.Close()
+
+	messages, err := ruletest.ReadMessages(f, readerConfig.ReaderID(), start)
+	if err != nil {
+		return errors.Annotatef(err, "read fixture %q", args.fixture)
+	}
+
+	logger := log.New().
+		WithConfig(log.NewConfigFromString(os.Getenv("TAILY_LOG"))).
+		WithNamespace("taily")
+
+	result, err := ruletest.Run(ctx, ruletest.Params{
+		Logger:     logger,
+		Config:     &cfg,
+		ReaderID:   readerConfig.ReaderID(),
+		Messages:   messages,
+		FlushAfter: args.flushAfter,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	printResult(result)
+
+	if mismatches := ruletest.Check(&cfg, expectations, result); len(mismatches) > 0 {
+		for _, mismatch := range mismatches {
+			fmt.Println("FAIL", mismatch)
+		}
+
+		return errors.Errorf("found %d mismatches", len(mismatches))
+	}
+
+	fmt.Println("PASS")
+
+	return nil
+}
+
+// readExpectations reads the expectations from the file.
+func readExpectations(filename string) (ruletest.Expectations, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ruletest.Expectations{}, errors.Trace(err)
+	}
+
+	defer f.Close()
+
+	e, err := ruletest.ReadExpectations(f)
+
+	return e, errors.Trace(err)
+}
+
+// printResult prints the calls of every action performed.
+func printResult(result ruletest.Result) {
+	names := make([]string, 0, len(result))
+
+	for name := range result {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for i, call := range result[name] {
+			fmt.Printf("%s call %d:\n  %s\n", name, i+1, strings.Join(call.Messages, "\n  "))
+		}
+	}
+}
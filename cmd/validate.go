@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jeremija/taily/factory"
+	"github.com/juju/errors"
+	"github.com/spf13/pflag"
+)
+
+// validate checks the config files strictly and prints all problems found
+// with their line numbers.
+func validate(argv []string) error {
+	fs := pflag.NewFlagSet("taily validate", pflag.ExitOnError)
+
+	var args struct {
+		config string
+	}
+
+	fs.StringVarP(&args.config, "config", "c", "", "config file to validate")
+
+	if err := fs.Parse(argv); err != nil {
+		return errors.Trace(err)
+	}
+
+	files := fs.Args()
+
+	if args.config != "" {
+		files = append([]string{args.config}, files...)
+	}
+
+	if len(files) == 0 {
+		return errors.Errorf("config file is required")
+	}
+
+	total := 0
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		problems := factory.ValidateYAML(data)
+
+		for _, problem := range problems {
+			if problem.Line > 0 {
+				fmt.Printf("%s:%d: %s\n", file, problem.Line, problem)
+			} else {
+				fmt.Printf("%s: %s\n", file, problem)
+			}
+		}
+
+		if len(problems) == 0 {
+			fmt.Printf("%s: OK\n", file)
+		}
+
+		total += len(problems)
+	}
+
+	if total > 0 {
+		return errors.Errorf("found %d problems", total)
+	}
+
+	return nil
+}
@@ -1,6 +1,11 @@
 package config
 
-import "github.com/jeremija/taily/types"
+import (
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
 
 // Config describes the main YAML config file.
 type Config struct {
@@ -8,6 +13,37 @@ type Config struct {
 	Actions    map[string]Action    `yaml:"actions"`
 	Processors map[string]Processor `yaml:"processors"`
 	Persister  Persister            `yaml:"persister"`
+	Supervisor Supervisor           `yaml:"supervisor"`
+	Shutdown   Shutdown             `yaml:"shutdown"`
+	HTTP       HTTP                 `yaml:"http"`
+	Health     Health               `yaml:"health"`
+}
+
+// Health contains configuration for the health checks. StallTimeout is the
+// time after which a running reader without a processed message or tick is
+// considered stuck, and ReadTimeout the time after which a running reader
+// that has stopped reading is.
+type Health struct {
+	StallTimeout time.Duration `yaml:"stall_timeout"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+}
+
+// HTTP contains configuration for the HTTP listener which serves the
+// metrics and health checks. The listener is disabled when Listen is empty.
+type HTTP struct {
+	Listen string `yaml:"listen"` // Listen is the address to listen on, e.g. :9090.
+}
+
+// Shutdown contains configuration for stopping the readers. Grace is the
+// time the buffered messages are still processed after a signal is received.
+type Shutdown struct {
+	Grace time.Duration `yaml:"grace"`
+}
+
+// Supervisor contains configuration for restarting failed readers.
+type Supervisor struct {
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
 }
 
 // Reader contains configuration for a specific watcher.
@@ -16,6 +52,31 @@ type Reader struct {
 	Type         string         `yaml:"type"`
 	Processors   []string       `yaml:"processors"`
 	InitialState types.State    `yaml:"initial_state"`
+	Composition  Composition    `yaml:"composition"`
+	Buffer       Buffer         `yaml:"buffer"`
+	Time         Time           `yaml:"time"`
+}
+
+// Time contains configuration for the time passed to processors. Mode is one
+// of: processing (default) or event.
+type Time struct {
+	Mode         string        `yaml:"mode"`
+	TickInterval time.Duration `yaml:"tick_interval"`
+}
+
+// Buffer contains configuration for buffering messages between the reader
+// and its processors. Overload is one of: block (default), drop or spill.
+type Buffer struct {
+	Size     int    `yaml:"size"`
+	Overload string `yaml:"overload"`
+	SpillDir string `yaml:"spill_dir"`
+}
+
+// Composition contains configuration for combining the reader's processors.
+// Type is one of: serial (default), isolated or parallel.
+type Composition struct {
+	Type       string `yaml:"type"`
+	BufferSize int    `yaml:"buffer_size"` // BufferSize per processor for parallel.
 }
 
 func (r Reader) ReaderID() types.ReaderID {
@@ -26,22 +87,117 @@ func (r Reader) ReaderID() types.ReaderID {
 	return types.ReaderID(r.Type)
 }
 
+// FindReader returns the config of the reader with readerID. When readerID is
+// empty, the config must contain a single reader.
+func (c *Config) FindReader(readerID types.ReaderID) (Reader, error) {
+	if readerID == "" {
+		if len(c.Readers) != 1 {
+			return Reader{}, errors.Errorf("reader is required when there are %d readers", len(c.Readers))
+		}
+
+		return c.Readers[0], nil
+	}
+
+	for _, readerConfig := range c.Readers {
+		if readerConfig.ReaderID() == readerID {
+			return readerConfig, nil
+		}
+	}
+
+	return Reader{}, errors.NotFoundf("reader %q", readerID)
+}
+
 // Processor contains configuration for a specific processor.
 type Processor struct {
-	Type    string           `yaml:"type"`
-	Action  string           `yaml:"action"`
-	Matcher ProcessorMatcher `yaml:"matcher"`
+	Type      string             `yaml:"type"`
+	Action    string             `yaml:"action"`
+	Actions   []ProcessorAction  `yaml:"actions"`
+	When      *Matcher           `yaml:"when"`
+	Matcher   ProcessorMatcher   `yaml:"matcher"`
+	Sequence  ProcessorSequence  `yaml:"sequence"`
+	Cluster   ProcessorCluster   `yaml:"cluster"`
+	Rate      ProcessorRate      `yaml:"rate"`
+	Transform ProcessorTransform `yaml:"transform"`
+	Redact    ProcessorRedact    `yaml:"redact"`
+}
+
+// ProcessorAction contains configuration for one of Processor.Actions. The
+// action is only performed when Matcher, if set, matches.
+type ProcessorAction struct {
+	Action  string   `yaml:"action"`
+	Matcher *Matcher `yaml:"matcher"`
 }
 
 // ProcessorMatcher contains cofiguration for ProcessorMatcher.
 type ProcessorMatcher struct {
+	Preset     string   `yaml:"preset"` // Preset is one of ProcessorMatcherPresets.
 	Start      *Matcher `yaml:"start_line"`
 	End        *Matcher `yaml:"end_line"`
-	IncludeEnd bool     `yaml:"include_end"`
+	IncludeEnd *bool    `yaml:"include_end"` // IncludeEnd overrides the preset when set.
 	MaxLines   int      `yaml:"max_lines"`
 	GroupBy    []string `yaml:"group_by"`
 }
 
+// ProcessorSequence contains configuration for ProcessorSequence.
+type ProcessorSequence struct {
+	Steps   []SequenceStep `yaml:"steps"`
+	Window  time.Duration  `yaml:"window"`
+	GroupBy []string       `yaml:"group_by"`
+}
+
+// SequenceStep contains configuration for a single ProcessorSequence step.
+type SequenceStep struct {
+	Matcher *Matcher `yaml:"matcher"`
+	Absent  bool     `yaml:"absent"`
+}
+
+// ProcessorCluster contains configuration for ProcessorCluster.
+type ProcessorCluster struct {
+	Matcher    *Matcher      `yaml:"matcher"`
+	Similarity float64       `yaml:"similarity"`
+	Warmup     time.Duration `yaml:"warmup"`
+}
+
+// ProcessorRate contains configuration for ProcessorRate.
+type ProcessorRate struct {
+	GroupBy  []string      `yaml:"group_by"`
+	Interval time.Duration `yaml:"interval"`
+	Alpha    float64       `yaml:"alpha"`
+	Factor   float64       `yaml:"factor"`
+	MinCount float64       `yaml:"min_count"`
+	Warmup   int           `yaml:"warmup"`
+	Season   time.Duration `yaml:"season"`
+}
+
+// ProcessorTransform contains configuration for ProcessorTransform.
+type ProcessorTransform struct {
+	Operations []TransformOperation `yaml:"operations"`
+}
+
+// TransformOperation contains configuration for a single ProcessorTransform
+// operation. Type is one of: rename, copy, drop, set or template.
+type TransformOperation struct {
+	Type     string   `yaml:"type"`
+	Field    string   `yaml:"field"`    // Field to modify.
+	From     string   `yaml:"from"`     // From is the source field for rename and copy.
+	Value    string   `yaml:"value"`    // Value is the constant for set.
+	Template Template `yaml:"template"` // Template for template.
+}
+
+// ProcessorRedact contains configuration for ProcessorRedact.
+type ProcessorRedact struct {
+	Builtin []string       `yaml:"builtin"` // Builtin redactors to use, or "all".
+	Custom  []CustomRedact `yaml:"custom"`
+	Fields  []string       `yaml:"fields"` // Fields to redact. Defaults to all.
+}
+
+// CustomRedact contains configuration for a custom redactor.
+type CustomRedact struct {
+	Name        string `yaml:"name"`
+	Regexp      string `yaml:"regexp"`
+	Replacement string `yaml:"replacement"`
+}
+
 // Matcher contains configuration for Matcher.
 type Matcher struct {
 	Type      string     `yaml:"type"`
@@ -67,8 +223,26 @@ type ProcessorAny struct {
 
 // Persister contains configuration for Persister.
 type Persister struct {
-	Type string        `yaml:"type"`
-	File PersisterFile `yaml:"file"`
+	Type       string        `yaml:"type"`
+	File       PersisterFile `yaml:"file"`
+	Bolt       PersisterBolt `yaml:"bolt"`
+	Checkpoint Checkpoint    `yaml:"checkpoint"`
+	Retention  Retention     `yaml:"retention"`
+}
+
+// Checkpoint contains configuration for persisting reader state while
+// reading. Readers checkpoint every Interval, or after Messages messages
+// have been processed when set.
+type Checkpoint struct {
+	Interval time.Duration `yaml:"interval"`
+	Messages int           `yaml:"messages"`
+}
+
+// Retention contains configuration for pruning state of removed docker
+// containers, and of containers not updated in MaxAge, when set.
+type Retention struct {
+	Interval time.Duration `yaml:"interval"`
+	MaxAge   time.Duration `yaml:"max_age"`
 }
 
 // PersisterFile contains configuration for PersisterFile.
@@ -76,10 +250,26 @@ type PersisterFile struct {
 	Dir string `yaml:"dir"`
 }
 
+// PersisterBolt contains configuration for PersisterBolt.
+type PersisterBolt struct {
+	Path    string `yaml:"path"`
+	History int    `yaml:"history"` // History is the number of states kept per reader.
+}
+
 type Action struct {
 	Type   string       `yaml:"type"`
 	Log    ActionLog    `yaml:"log"`
 	Notify ActionNotify `yaml:"notify"`
+	Retry  ActionRetry  `yaml:"retry"`
+}
+
+// ActionRetry configures the retries of a failed action. Attempts is the
+// maximum number of attempts, including the first one, so the action is not
+// retried when it is at most 1. Backoff is the delay before the first retry,
+// which is doubled for every following one.
+type ActionRetry struct {
+	Attempts int           `yaml:"attempts"`
+	Backoff  time.Duration `yaml:"backoff"`
 }
 
 type Format struct {
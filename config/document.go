@@ -0,0 +1,150 @@
+package config
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem describes an invalid value in the config.
+type Problem struct {
+	Line int      // Line of the value in the YAML document, or 0 when unknown.
+	Path []string // Path to the value, e.g. processors, errors, when. Optional.
+	Err  error
+}
+
+// String returns the problem prefixed with its path, when known.
+func (p Problem) String() string {
+	var b strings.Builder
+
+	if len(p.Path) > 0 {
+		b.WriteString(strings.Join(p.Path, "."))
+		b.WriteString(": ")
+	}
+
+	b.WriteString(p.Err.Error())
+
+	return b.String()
+}
+
+// Document is a decoded YAML config document. It is used to locate the
+// config values by their path.
+type Document struct {
+	root *yaml.Node
+}
+
+// lineRegexp matches the line prefix of yaml.v3 errors.
+var lineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlProblems converts the yaml.v3 error to problems, extracting the line
+// numbers from the messages.
+func yamlProblems(err error) []Problem {
+	var messages []string
+
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	ret := make([]Problem, len(messages))
+
+	for i, message := range messages {
+		problem := Problem{
+			Err: errors.New(strings.TrimPrefix(message, "yaml: ")),
+		}
+
+		if m := lineRegexp.FindStringSubmatch(message); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			problem.Err = errors.New(m[2])
+		}
+
+		ret[i] = problem
+	}
+
+	return ret
+}
+
+// DecodeStrict decodes the YAML config from data. Unlike FromYAMLReader,
+// unknown keys are reported as problems. The config is still decoded as far
+// as possible, so it can be validated further. When the YAML cannot be
+// decoded, e.g. due to a syntax error or a duplicate key, the returned Config
+// and Document are nil.
+func DecodeStrict(data []byte) (*Config, *Document, []Problem) {
+	var root yaml.Node
+
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, yamlProblems(err)
+	}
+
+	var (
+		c        Config
+		problems []Problem
+	)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	// An empty document results in io.EOF and an empty config.
+	if err := decoder.Decode(&c); err != nil && root.Kind != 0 {
+		if _, ok := err.(*yaml.TypeError); !ok {
+			// Decoding stopped, so the config is incomplete.
+			return nil, nil, yamlProblems(err)
+		}
+
+		problems = yamlProblems(err)
+	}
+
+	return &c, &Document{root: &root}, problems
+}
+
+// Line returns the line of the value at path. The keys of mappings and the
+// indexes of sequences are used as path elements. When the value is not
+// defined, the line of its closest defined parent is returned, or 0 when
+// none is.
+func (d *Document) Line(path []string) int {
+	node := d.root
+
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := 0
+
+	for _, elem := range path {
+		next, nextLine := child(node, elem)
+		if next == nil {
+			break
+		}
+
+		node = next
+		line = nextLine
+	}
+
+	return line
+}
+
+// child returns the child of node with the key or index elem, and its line.
+// The line of a mapping value is the line of its key. It returns nil when
+// there is no such child.
+func child(node *yaml.Node, elem string) (*yaml.Node, int) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if key := node.Content[i]; key.Value == elem {
+				return node.Content[i+1], key.Line
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(elem)
+		if err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i], node.Content[i].Line
+		}
+	}
+
+	return nil, 0
+}
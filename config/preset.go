@@ -0,0 +1,170 @@
+package config
+
+import (
+	"sort"
+
+	"github.com/juju/errors"
+)
+
+// ProcessorMatcherPresets contains the built-in ProcessorMatcher definitions
+// for common crash signatures. They can be referenced by name from
+// ProcessorMatcher.Preset.
+var ProcessorMatcherPresets = map[string]ProcessorMatcher{
+	// golang_panic matches Go panics and fatal runtime errors, including the
+	// goroutine stack traces that follow.
+	"golang_panic": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `(or (pre "panic: ") (pre "fatal error: "))`,
+		},
+		End: &Matcher{
+			Type: "expr",
+			Expr: `
+				(not
+					(or
+						(eq "")
+						(pre "goroutine ")
+						(pre "[signal ")
+						(pre "created by ")
+						(re "^\\s")
+						(re "^[\\w./*()\\[\\]{}-]+\\(.*\\)$")
+					)
+				)
+			`,
+		},
+		GroupBy:  []string{"_PID"},
+		MaxLines: 100,
+	},
+	// java_exception matches uncaught Java exceptions together with their
+	// "at" frames and "Caused by" chains.
+	"java_exception": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `(re "^(Exception in thread \"[^\"]*\" )?([\\w$]+\\.)+[\\w$]*(Exception|Error)(: .*)?$")`,
+		},
+		End: &Matcher{
+			Type: "expr",
+			Expr: `(not (re "^\\s*(at |\\.\\.\\. \\d+ (more|common frames omitted)|Caused by: |Suppressed: )"))`,
+		},
+		GroupBy:  []string{"_PID"},
+		MaxLines: 100,
+	},
+	// python_traceback matches Python tracebacks up to and including the final
+	// exception line.
+	"python_traceback": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `(eq "Traceback (most recent call last):")`,
+		},
+		End: &Matcher{
+			Type: "expr",
+			Expr: `(re "^\\S")`,
+		},
+		IncludeEnd: newBool(true),
+		GroupBy:    []string{"_PID"},
+		MaxLines:   100,
+	},
+	// node_unhandled_rejection matches Node.js unhandled promise rejections
+	// together with the indented stack trace and error properties.
+	"node_unhandled_rejection": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `(or (substring "UnhandledPromiseRejection") (substring "ERR_UNHANDLED_REJECTION"))`,
+		},
+		End: &Matcher{
+			Type: "expr",
+			Expr: `(not (or (re "^\\s") (eq "}")))`,
+		},
+		GroupBy:  []string{"_PID"},
+		MaxLines: 50,
+	},
+	// kernel_oom matches processes killed by the kernel OOM killer, both
+	// system-wide and cgroup-scoped.
+	"kernel_oom": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `(re "(Out of memory|Memory cgroup out of memory): Kill(ed)? process")`,
+		},
+	},
+	// segfault matches segmentation faults reported by the kernel, the shell
+	// or systemd.
+	"segfault": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `
+				(or
+					(re "segfault at [0-9a-f]+ ip ")
+					(substring "Segmentation fault")
+					(substring "status=11/SEGV")
+				)
+			`,
+		},
+	},
+	// systemd_unit_failure matches units that systemd reports as failed.
+	"systemd_unit_failure": {
+		Start: &Matcher{
+			Type: "expr",
+			Expr: `
+				(field "SYSLOG_IDENTIFIER" "^systemd$")
+				(or
+					(re "^\\S+: Failed with result '[^']+'\\.$")
+					(pre "Failed to start ")
+				)
+			`,
+		},
+	},
+}
+
+// ProcessorMatcherPresetNames returns the sorted names of all built-in
+// presets.
+func ProcessorMatcherPresetNames() []string {
+	names := make([]string, 0, len(ProcessorMatcherPresets))
+
+	for name := range ProcessorMatcherPresets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Expand returns a copy of ProcessorMatcher with the Preset applied. Settings
+// defined explicitly take precedence over the ones from the preset.
+func (p ProcessorMatcher) Expand() (ProcessorMatcher, error) {
+	if p.Preset == "" {
+		return p, nil
+	}
+
+	ret, ok := ProcessorMatcherPresets[p.Preset]
+	if !ok {
+		return ProcessorMatcher{}, errors.Errorf("unknown matcher preset: %q", p.Preset)
+	}
+
+	if p.Start != nil {
+		ret.Start = p.Start
+	}
+
+	if p.End != nil {
+		ret.End = p.End
+	}
+
+	if p.MaxLines > 0 {
+		ret.MaxLines = p.MaxLines
+	}
+
+	if len(p.GroupBy) > 0 {
+		ret.GroupBy = p.GroupBy
+	}
+
+	if p.IncludeEnd != nil {
+		ret.IncludeEnd = p.IncludeEnd
+	}
+
+	return ret, nil
+}
+
+// newBool returns a pointer to b.
+func newBool(b bool) *bool {
+	return &b
+}
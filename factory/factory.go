@@ -2,17 +2,23 @@ package factory
 
 import (
 	"os"
+	"regexp"
+	"time"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
-	"github.com/docker/docker/client"
 	"github.com/jeremija/taily/action"
+	"github.com/jeremija/taily/clock"
 	"github.com/jeremija/taily/config"
 	"github.com/jeremija/taily/formatter"
 	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/metrics"
 	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/pipeline"
 	"github.com/jeremija/taily/processor"
 	"github.com/jeremija/taily/reader"
+	"github.com/jeremija/taily/supervisor"
 	"github.com/jeremija/taily/types"
+	"github.com/jeremija/taily/watcher"
 	"github.com/juju/errors"
 	"github.com/peer-calls/log"
 )
@@ -47,6 +53,23 @@ func NewAction(logger log.Logger, cfg config.Action) (types.Action, error) {
 	}
 }
 
+// NewActionRetry wraps a with action.Retry when cfg allows more than one
+// attempt, and returns a unchanged otherwise. The onRetry is called before
+// every retry.
+func NewActionRetry(logger log.Logger, cfg config.ActionRetry, a types.Action, onRetry func()) types.Action {
+	if cfg.Attempts <= 1 {
+		return a
+	}
+
+	return action.NewRetry(action.RetryParams{
+		Logger:   logger,
+		Action:   a,
+		Attempts: cfg.Attempts,
+		Backoff:  cfg.Backoff,
+		OnRetry:  onRetry,
+	})
+}
+
 func NewFormatter(cfg config.Format) (types.Formatter, error) {
 	switch cfg.Type {
 	case "plain":
@@ -54,17 +77,7 @@ func NewFormatter(cfg config.Format) (types.Formatter, error) {
 	case "json":
 		return formatter.NewJSON(), nil
 	case "template":
-		var opts []formatter.TemplateOpt
-
-		if cfg.Template.OpenTag > 0 || cfg.Template.CloseTag > 0 {
-			opts = append(opts, formatter.WithQuotes(cfg.Template.OpenTag, cfg.Template.CloseTag))
-		}
-
-		if cfg.Template.OpenQuote > 0 || cfg.Template.CloseQuote > 0 {
-			opts = append(opts, formatter.WithQuotes(cfg.Template.OpenQuote, cfg.Template.CloseQuote))
-		}
-
-		t, err := formatter.NewTemplate(cfg.Template.Format, opts...)
+		t, err := formatter.NewTemplate(cfg.Template.Format, NewTemplateOpts(cfg.Template)...)
 
 		return t, errors.Trace(err)
 	default:
@@ -72,6 +85,21 @@ func NewFormatter(cfg config.Format) (types.Formatter, error) {
 	}
 }
 
+// NewTemplateOpts converts the template config to formatter options.
+func NewTemplateOpts(cfg config.Template) []formatter.TemplateOpt {
+	var opts []formatter.TemplateOpt
+
+	if cfg.OpenTag > 0 || cfg.CloseTag > 0 {
+		opts = append(opts, formatter.WithTags(cfg.OpenTag, cfg.CloseTag))
+	}
+
+	if cfg.OpenQuote > 0 || cfg.CloseQuote > 0 {
+		opts = append(opts, formatter.WithQuotes(cfg.OpenQuote, cfg.CloseQuote))
+	}
+
+	return opts
+}
+
 func NewActionLog(cfg config.ActionLog) (*action.Log, error) {
 	f, err := NewFormatter(cfg.Format)
 	if err != nil {
@@ -107,15 +135,68 @@ func NewActionNotify(logger log.Logger, cfg config.ActionNotify) (*action.Notify
 	}), nil
 }
 
+// NewProcessorsMap creates a processor.Factory for every processor config.
+// The matches of each processor are recorded by m, when set. The processors
+// shared by all readers are kept in shared, when set.
 func NewProcessorsMap(
+	logger log.Logger,
 	cfgs map[string]config.Processor,
 	actionsMap map[string]types.Action,
+	persister types.Persister,
+	m *metrics.Metrics,
+	shared *Shared,
 ) (map[string]processor.Factory, error) {
 	ret := make(map[string]processor.Factory, len(cfgs))
 
 	for procName, procConfig := range cfgs {
+		procName, procConfig := procName, procConfig
+
+		// The following processors keep state that should be shared between
+		// all readers, so a single instance is used.
+		var (
+			single types.Processor
+			err    error
+		)
+
+		switch procConfig.Type {
+		case "cluster":
+			single, err = shared.processor(procName, procConfig, func() (types.Processor, error) {
+				proc, err := NewProcessorCluster(procName, procConfig, actionsMap, persister, m)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+
+				when, err := NewProcessorWhen(procConfig, proc)
+
+				return when, errors.Trace(err)
+			})
+		case "redact":
+			single, err = shared.processor(procName, procConfig, func() (types.Processor, error) {
+				proc, err := NewProcessorRedact(logger, procConfig.Redact)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+
+				when, err := NewProcessorWhen(procConfig, proc)
+
+				return when, errors.Trace(err)
+			})
+		}
+
+		if err != nil {
+			return nil, errors.Annotatef(err, "processor %q", procName)
+		}
+
+		if single != nil {
+			ret[procName] = func() (types.Processor, error) {
+				return single, nil
+			}
+
+			continue
+		}
+
 		ret[procName] = func() (types.Processor, error) {
-			processor, err := NewProcessor(procConfig, actionsMap)
+			processor, err := newProcessorWithMatches(procName, procConfig, actionsMap, m)
 
 			return processor, errors.Trace(err)
 		}
@@ -124,9 +205,15 @@ func NewProcessorsMap(
 	return ret, nil
 }
 
-// NewProcessorsFromMap reads configs and creates Processors.
-func NewProcessorsFromMap(processorsMap map[string]processor.Factory, names []string) (processor.Factory, error) {
-	factories := make([]processor.Factory, len(processorsMap))
+// NewProcessorsFromMap reads configs and creates Processors combined
+// according to composition.
+func NewProcessorsFromMap(
+	logger log.Logger,
+	processorsMap map[string]processor.Factory,
+	names []string,
+	composition config.Composition,
+) (processor.Factory, error) {
+	factories := make([]processor.Factory, len(names))
 
 	for i, name := range names {
 		proc, ok := processorsMap[name]
@@ -137,19 +224,36 @@ func NewProcessorsFromMap(processorsMap map[string]processor.Factory, names []st
 		factories[i] = proc
 	}
 
+	if !isKnownType(CompositionTypes, composition.Type) {
+		return nil, errors.Errorf("unknown composition: %q", composition.Type)
+	}
+
 	newProcessor := func() (types.Processor, error) {
-		ret := make(processor.Serial, len(names))
+		procs := make([]types.Processor, len(names))
 
 		for i, newProcessor := range factories {
-			var err error
-
-			ret[i], err = newProcessor()
+			proc, err := newProcessor()
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
+
+			// The state of the processors is kept by name across reloads and
+			// restarts.
+			procs[i] = processor.NewNamed(names[i], proc)
 		}
 
-		return ret, nil
+		switch composition.Type {
+		case "isolated":
+			return processor.Isolated(procs), nil
+		case "parallel":
+			return processor.NewParallel(processor.ParallelParams{
+				Logger:     logger,
+				Processors: procs,
+				BufferSize: composition.BufferSize,
+			}), nil
+		default:
+			return processor.Serial(procs), nil
+		}
 	}
 
 	return newProcessor, nil
@@ -157,24 +261,149 @@ func NewProcessorsFromMap(processorsMap map[string]processor.Factory, names []st
 
 // NewProcessor reads config and creates a Processor.
 func NewProcessor(cfg config.Processor, actionsMap map[string]types.Action) (types.Processor, error) {
-	action, ok := actionsMap[cfg.Action]
-	if !ok {
-		return nil, errors.Errorf("undefined action: %q", cfg.Action)
+	proc, err := newProcessorWithMatches("", cfg, actionsMap, nil)
+
+	return proc, errors.Trace(err)
+}
+
+// newProcessorWithMatches reads config and creates a Processor whose matches
+// are recorded by m under name, when m is set.
+func newProcessorWithMatches(
+	name string,
+	cfg config.Processor,
+	actionsMap map[string]types.Action,
+	m *metrics.Metrics,
+) (types.Processor, error) {
+	proc, err := newProcessor(name, cfg, actionsMap, m)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	proc, err = NewProcessorWhen(cfg, proc)
+
+	return proc, errors.Trace(err)
+}
+
+// NewProcessorWhen wraps proc with processor.When when the config defines
+// the when matcher.
+func NewProcessorWhen(cfg config.Processor, proc types.Processor) (types.Processor, error) {
+	if cfg.When == nil {
+		return proc, nil
+	}
+
+	m, err := NewMatcher(cfg.When)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return processor.NewWhen(m, proc), nil
+}
+
+// NewProcessorAction creates the action for a processor from config. When
+// multiple actions are defined, an action.Multi is returned.
+func NewProcessorAction(cfg config.Processor, actionsMap map[string]types.Action) (types.Action, error) {
+	if len(cfg.Actions) == 0 {
+		a, ok := actionsMap[cfg.Action]
+		if !ok {
+			return nil, errors.Errorf("undefined action: %q", cfg.Action)
+		}
+
+		return a, nil
+	}
+
+	if cfg.Action != "" {
+		return nil, errors.Errorf("action and actions are mutually exclusive")
+	}
+
+	ret := make(action.Multi, len(cfg.Actions))
+
+	for i, actionConfig := range cfg.Actions {
+		a, ok := actionsMap[actionConfig.Action]
+		if !ok {
+			return nil, errors.Errorf("undefined action: %q", actionConfig.Action)
+		}
+
+		var m types.Matcher
+
+		if actionConfig.Matcher != nil {
+			var err error
+
+			m, err = NewMatcher(actionConfig.Matcher)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+
+		ret[i] = action.MultiAction{
+			Matcher: m,
+			Action:  a,
+		}
+	}
+
+	return ret, nil
+}
+
+// newProcessorAction creates the action for the processor with name from
+// config, and records its matches with m, when set. The action is wrapped
+// once, so a match that performs several actions is counted once.
+func newProcessorAction(
+	name string,
+	cfg config.Processor,
+	actionsMap map[string]types.Action,
+	m *metrics.Metrics,
+) (types.Action, error) {
+	a, err := NewProcessorAction(cfg, actionsMap)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return m.Matches(name, a), nil
+}
+
+func newProcessor(
+	name string,
+	cfg config.Processor,
+	actionsMap map[string]types.Action,
+	m *metrics.Metrics,
+) (types.Processor, error) {
+	// Transform processors only modify messages for the subsequent processors
+	// so they do not need an action.
+	if cfg.Type == "transform" {
+		operations, err := NewTransformOperations(cfg.Transform.Operations)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return processor.NewTransform(operations), nil
+	}
+
+	action, err := newProcessorAction(name, cfg, actionsMap, m)
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
 
 	switch cfg.Type {
 	case "any":
 		return processor.NewAny(action), nil
 	case "matcher":
-		startLine, err := NewMatcher(cfg.Matcher.Start)
+		matcherConfig, err := cfg.Matcher.Expand()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if matcherConfig.Start == nil {
+			return nil, errors.Errorf("matcher processor requires start_line or preset")
+		}
+
+		startLine, err := NewMatcher(matcherConfig.Start)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 
 		var endLine types.Matcher
 
-		if cfg.Matcher.End != nil {
-			endLine, err = NewMatcher(cfg.Matcher.End)
+		if matcherConfig.End != nil {
+			endLine, err = NewMatcher(matcherConfig.End)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
@@ -183,16 +412,210 @@ func NewProcessor(cfg config.Processor, actionsMap map[string]types.Action) (typ
 		return processor.NewMatcher(processor.MatcherParams{
 			StartLine:  startLine,
 			EndLine:    endLine,
-			IncludeEnd: cfg.Matcher.IncludeEnd,
-			GroupBy:    cfg.Matcher.GroupBy,
-			MaxLines:   cfg.Matcher.MaxLines,
+			IncludeEnd: matcherConfig.IncludeEnd != nil && *matcherConfig.IncludeEnd,
+			GroupBy:    matcherConfig.GroupBy,
+			MaxLines:   matcherConfig.MaxLines,
 			Action:     action,
 		}), nil
+	case "sequence":
+		steps, err := NewSequenceSteps(cfg.Sequence.Steps)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if cfg.Sequence.Window <= 0 {
+			return nil, errors.Errorf("sequence processor requires a positive window")
+		}
+
+		return processor.NewSequence(processor.SequenceParams{
+			Steps:   steps,
+			Window:  cfg.Sequence.Window,
+			GroupBy: cfg.Sequence.GroupBy,
+			Action:  action,
+		}), nil
+	case "rate":
+		rate, err := processor.NewRate(processor.RateParams{
+			GroupBy:  cfg.Rate.GroupBy,
+			Interval: cfg.Rate.Interval,
+			Alpha:    cfg.Rate.Alpha,
+			Factor:   cfg.Rate.Factor,
+			MinCount: cfg.Rate.MinCount,
+			Warmup:   cfg.Rate.Warmup,
+			Season:   cfg.Rate.Season,
+			Action:   action,
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return rate, nil
 	default:
 		return nil, errors.Errorf("unknown processor: %q", cfg.Type)
 	}
 }
 
+// NewTransformOperations creates operations for the transform processor from
+// config.
+func NewTransformOperations(cfgs []config.TransformOperation) ([]processor.TransformOperation, error) {
+	ret := make([]processor.TransformOperation, len(cfgs))
+
+	for i, cfg := range cfgs {
+		op, err := NewTransformOperation(cfg)
+		if err != nil {
+			return nil, errors.Annotatef(err, "transform operation %d", i)
+		}
+
+		ret[i] = op
+	}
+
+	return ret, nil
+}
+
+// NewTransformOperation creates a single transform operation from config.
+func NewTransformOperation(cfg config.TransformOperation) (processor.TransformOperation, error) {
+	if cfg.Field == "" {
+		return nil, errors.Errorf("field is required")
+	}
+
+	switch cfg.Type {
+	case "rename", "copy":
+		if cfg.From == "" {
+			return nil, errors.Errorf("from is required for %s", cfg.Type)
+		}
+	}
+
+	switch cfg.Type {
+	case "rename":
+		return processor.TransformRename(cfg.From, cfg.Field), nil
+	case "copy":
+		return processor.TransformCopy(cfg.From, cfg.Field), nil
+	case "drop":
+		return processor.TransformDrop(cfg.Field), nil
+	case "set":
+		return processor.TransformSet(cfg.Field, cfg.Value), nil
+	case "template":
+		// Values should not be quoted by default when building fields.
+		opts := append([]formatter.TemplateOpt{formatter.WithQuotes(0, 0)}, NewTemplateOpts(cfg.Template)...)
+
+		t, err := formatter.NewTemplate(cfg.Template.Format, opts...)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return processor.TransformFormat(cfg.Field, t), nil
+	default:
+		return nil, errors.Errorf("unknown transform operation: %q", cfg.Type)
+	}
+}
+
+// NewSequenceSteps creates steps for the sequence processor from config.
+func NewSequenceSteps(cfgs []config.SequenceStep) ([]processor.SequenceStep, error) {
+	if len(cfgs) < 2 {
+		return nil, errors.Errorf("sequence processor requires at least two steps")
+	}
+
+	ret := make([]processor.SequenceStep, len(cfgs))
+
+	for i, cfg := range cfgs {
+		if cfg.Matcher == nil {
+			return nil, errors.Errorf("sequence step %d requires a matcher", i)
+		}
+
+		if cfg.Absent && i != len(cfgs)-1 {
+			return nil, errors.Errorf("sequence step %d: only the last step can be absent", i)
+		}
+
+		m, err := NewMatcher(cfg.Matcher)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		ret[i] = processor.SequenceStep{
+			Matcher: m,
+			Absent:  cfg.Absent,
+		}
+	}
+
+	return ret, nil
+}
+
+// NewProcessorCluster creates a new cluster processor from config. The known
+// templates are persisted under the processor name, and the matches are
+// recorded by m, when set.
+func NewProcessorCluster(
+	name string,
+	cfg config.Processor,
+	actionsMap map[string]types.Action,
+	persister types.Persister,
+	m *metrics.Metrics,
+) (*processor.Cluster, error) {
+	action, err := newProcessorAction(name, cfg, actionsMap, m)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var clusterMatcher types.Matcher
+
+	if cfg.Cluster.Matcher != nil {
+		clusterMatcher, err = NewMatcher(cfg.Cluster.Matcher)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return processor.NewCluster(processor.ClusterParams{
+		Persister:  persister,
+		Key:        "cluster_" + name,
+		Matcher:    clusterMatcher,
+		Similarity: cfg.Cluster.Similarity,
+		Warmup:     cfg.Cluster.Warmup,
+		Action:     action,
+	}), nil
+}
+
+// NewProcessorRedact creates a new redact processor from config.
+func NewProcessorRedact(logger log.Logger, cfg config.ProcessorRedact) (*processor.Redact, error) {
+	names := cfg.Builtin
+
+	if len(names) == 1 && names[0] == "all" {
+		names = processor.BuiltinRedactorNames
+	}
+
+	redactors := make([]processor.Redactor, 0, len(names)+len(cfg.Custom))
+
+	for _, name := range names {
+		r, ok := processor.BuiltinRedactors[name]
+		if !ok {
+			return nil, errors.Errorf("unknown builtin redactor: %q", name)
+		}
+
+		redactors = append(redactors, r)
+	}
+
+	for _, custom := range cfg.Custom {
+		re, err := regexp.Compile(custom.Regexp)
+		if err != nil {
+			return nil, errors.Annotatef(err, "custom redactor %q", custom.Name)
+		}
+
+		redactors = append(redactors, processor.Redactor{
+			Name:        custom.Name,
+			Regexp:      re,
+			Replacement: custom.Replacement,
+		})
+	}
+
+	if len(redactors) == 0 {
+		return nil, errors.Errorf("redact processor requires at least one redactor")
+	}
+
+	return processor.NewRedact(processor.RedactParams{
+		Logger:    logger,
+		Redactors: redactors,
+		Fields:    cfg.Fields,
+	}), nil
+}
+
 func NewMatchers(cfgs []*config.Matcher) ([]types.Matcher, error) {
 	ret := make([]types.Matcher, len(cfgs))
 
@@ -211,6 +634,10 @@ func NewMatchers(cfgs []*config.Matcher) ([]types.Matcher, error) {
 // NewMatcher creates a new Mather from config. The field is just
 // used for debugging.
 func NewMatcher(cfg *config.Matcher) (types.Matcher, error) {
+	if cfg == nil {
+		return nil, errors.Errorf("matcher is required")
+	}
+
 	switch cfg.Type {
 	case "expr":
 		m, err := matcher.Compile(cfg.Expr)
@@ -265,17 +692,97 @@ func NewPersister(cfg config.Persister) (types.Persister, error) {
 	case "noop":
 		return persister.NewNoop(), nil
 	case "file":
-		return persister.NewFile(cfg.File.Dir), nil
+		p := persister.NewFile(cfg.File.Dir)
+
+		if err := p.Lock(); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return p, nil
+	case "bolt":
+		p, err := persister.NewBolt(persister.BoltParams{
+			Path:    cfg.Bolt.Path,
+			History: cfg.Bolt.History,
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return p, nil
 	default:
 		return nil, errors.Errorf("unknown persister: %q", cfg.Type)
 	}
 }
 
-// NewReader creates a new Reader from config.
+// NewCheckpoint creates watcher.Checkpoint from config.
+func NewCheckpoint(cfg config.Checkpoint) watcher.Checkpoint {
+	return watcher.Checkpoint{
+		Interval: cfg.Interval,
+		Messages: cfg.Messages,
+	}
+}
+
+// NewRetention creates persister.Retention from config.
+func NewRetention(cfg config.Retention) persister.Retention {
+	return persister.Retention{
+		Interval: cfg.Interval,
+		MaxAge:   cfg.MaxAge,
+	}
+}
+
+// NewRestart creates the supervisor.Params of restarting failed readers from
+// config.
+func NewRestart(logger log.Logger, cfg config.Supervisor) supervisor.Params {
+	return supervisor.Params{
+		Logger:     logger,
+		MinBackoff: cfg.MinBackoff,
+		MaxBackoff: cfg.MaxBackoff,
+	}
+}
+
+// NewBuffer creates pipeline.Buffer from config.
+func NewBuffer(cfg config.Buffer) (pipeline.Buffer, error) {
+	buffer := pipeline.Buffer{
+		Size:     cfg.Size,
+		Overload: pipeline.Overload(cfg.Overload),
+		SpillDir: cfg.SpillDir,
+	}
+
+	return buffer, errors.Trace(buffer.Validate())
+}
+
+// NewTime creates pipeline.Time from config.
+func NewTime(cfg config.Time) (pipeline.Time, error) {
+	t := pipeline.Time{
+		Clock:        clock.New(),
+		TickInterval: cfg.TickInterval,
+		Mode:         pipeline.TimeMode(cfg.Mode),
+	}
+
+	return t, errors.Trace(t.Validate())
+}
+
+// NewShutdownGrace returns the shutdown grace period from config.
+func NewShutdownGrace(cfg config.Shutdown) time.Duration {
+	if cfg.Grace <= 0 {
+		return pipeline.DefaultShutdownGrace
+	}
+
+	return cfg.Grace
+}
+
+// NewReader creates a new Reader from config. The docker client is kept in
+// shared, when set.
 func NewReader(
 	logger log.Logger,
 	persister types.Persister,
 	newProcessor processor.Factory,
+	checkpoint watcher.Checkpoint,
+	retention persister.Retention,
+	shutdownGrace time.Duration,
+	restart supervisor.Params,
+	m *metrics.Metrics,
+	shared *Shared,
 	cfg config.Reader,
 ) (types.Reader, error) {
 	watcherParams := types.ReaderParams{
@@ -293,18 +800,34 @@ func NewReader(
 		return reader.NewJournald(params), nil
 
 	case "docker":
-		cl, err := client.NewClientWithOpts(
-			client.FromEnv,
-		)
+		cl, err := shared.dockerClient()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		buffer, err := NewBuffer(cfg.Buffer)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		t, err := NewTime(cfg.Time)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 
 		params := reader.DockerParams{
-			ReaderParams: watcherParams,
-			Client:       cl,
-			Persister:    persister,
-			NewProcessor: newProcessor,
+			ReaderParams:  watcherParams,
+			Client:        cl,
+			Persister:     persister,
+			NewProcessor:  newProcessor,
+			Checkpoint:    checkpoint,
+			Retention:     retention,
+			Buffer:        buffer,
+			Time:          t,
+			ShutdownGrace: shutdownGrace,
+			Metrics:       m,
+			InitialState:  cfg.InitialState,
+			Restart:       restart,
 		}
 
 		return reader.NewDocker(params), nil
@@ -0,0 +1,92 @@
+package factory
+
+import (
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Fingerprint identifies the configuration of a reader so that the changes
+// can be detected upon reload.
+type Fingerprint struct {
+	// Reader covers the configuration which requires the pipeline to be
+	// restarted.
+	Reader string
+	// Processors covers the configuration of the processors and actions,
+	// which can be swapped without restarting the pipeline.
+	Processors string
+}
+
+// readerFingerprint contains the configuration covered by
+// Fingerprint.Reader.
+type readerFingerprint struct {
+	Reader     config.Reader     `yaml:"reader"`
+	Checkpoint config.Checkpoint `yaml:"checkpoint"`
+	Retention  config.Retention  `yaml:"retention"`
+	Shutdown   config.Shutdown   `yaml:"shutdown"`
+}
+
+// processorsFingerprint contains the configuration covered by
+// Fingerprint.Processors.
+type processorsFingerprint struct {
+	Names       []string                 `yaml:"names"`
+	Composition config.Composition       `yaml:"composition"`
+	Processors  []config.Processor       `yaml:"processors"`
+	Actions     map[string]config.Action `yaml:"actions"`
+}
+
+// NewFingerprints returns the Fingerprint of every reader. The processors of
+// the docker reader are a part of Fingerprint.Reader because they are also
+// used by the container pipelines, which cannot be swapped.
+func NewFingerprints(cfg *config.Config) (map[types.ReaderID]Fingerprint, error) {
+	ret := make(map[types.ReaderID]Fingerprint, len(cfg.Readers))
+
+	for _, readerConfig := range cfg.Readers {
+		procs := processorsFingerprint{
+			Names:       readerConfig.Processors,
+			Composition: readerConfig.Composition,
+			Processors:  make([]config.Processor, len(readerConfig.Processors)),
+			Actions:     cfg.Actions,
+		}
+
+		for i, name := range readerConfig.Processors {
+			procs.Processors[i] = cfg.Processors[name]
+		}
+
+		processors, err := yaml.Marshal(procs)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		r := readerFingerprint{
+			Reader:     readerConfig,
+			Checkpoint: cfg.Persister.Checkpoint,
+			Retention:  cfg.Persister.Retention,
+			Shutdown:   cfg.Shutdown,
+		}
+
+		if r.Reader.Type != "docker" {
+			r.Reader.Processors = nil
+			r.Reader.Composition = config.Composition{}
+		}
+
+		reader, err := yaml.Marshal(r)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		fingerprint := Fingerprint{
+			Reader:     string(reader),
+			Processors: string(processors),
+		}
+
+		if r.Reader.Type == "docker" {
+			fingerprint.Reader += fingerprint.Processors
+		}
+
+		ret[readerConfig.ReaderID()] = fingerprint
+	}
+
+	return ret, nil
+}
@@ -1,71 +1,265 @@
 package factory
 
 import (
+	"time"
+
 	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/health"
+	"github.com/jeremija/taily/metrics"
+	"github.com/jeremija/taily/persister"
 	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/supervisor"
 	"github.com/jeremija/taily/types"
 	"github.com/jeremija/taily/watcher"
 	"github.com/juju/errors"
 	"github.com/peer-calls/log"
 )
 
-func NewPipelines(logger log.Logger, cfg *config.Config) ([]*pipeline.Pipeline, error) {
+// NewPipelines creates a pipeline for the readers in readerIDs, or for every
+// reader when readerIDs is nil. The persister, created by NewPersister, is
+// shared by all pipelines so that it can be kept across config reloads, and
+// so are the instances kept in shared, see Shared. Metrics are recorded by m,
+// when set.
+func NewPipelines(
+	logger log.Logger,
+	cfg *config.Config,
+	persister types.Persister,
+	m *metrics.Metrics,
+	shared *Shared,
+	readerIDs map[types.ReaderID]struct{},
+) ([]*pipeline.Pipeline, error) {
 	actionsMap, err := NewActionsMap(logger, cfg.Actions)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	persister, err := NewPersister(cfg.Persister)
-	if err != nil {
-		return nil, errors.Trace(err)
+	for name, a := range actionsMap {
+		name := name
+
+		a = NewActionRetry(logger, cfg.Actions[name].Retry, a, func() {
+			m.ActionRetried(name)
+		})
+
+		actionsMap[name] = m.Action(name, a)
 	}
 
-	processorsMap, err := NewProcessorsMap(cfg.Processors, actionsMap)
+	pipelines, err := newPipelines(logger, cfg, actionsMap, persister, m, shared, readerIDs, time.Time{}, time.Time{})
+
+	return pipelines, errors.Trace(err)
+}
+
+// NewHistoryPipelines creates a pipeline for every reader that processes the
+// logs between since and until, and then completes. The processors perform
+// the actions from actionsMap instead of the configured ones. No state is
+// loaded or persisted, and the event time mode is always used.
+func NewHistoryPipelines(
+	logger log.Logger,
+	cfg *config.Config,
+	actionsMap map[string]types.Action,
+	since time.Time,
+	until time.Time,
+) ([]*pipeline.Pipeline, error) {
+	if until.IsZero() {
+		return nil, errors.Errorf("until is required")
+	}
+
+	pipelines, err := newPipelines(logger, cfg, actionsMap, persister.NewNoop(), nil, nil, nil, since, until)
+
+	return pipelines, errors.Trace(err)
+}
+
+// NoWarmup returns a copy of cfgs with the warmup of the cluster processors
+// disabled, for the runs that process past logs without persisted state,
+// which would otherwise never report the first new templates.
+func NoWarmup(cfgs map[string]config.Processor) map[string]config.Processor {
+	ret := make(map[string]config.Processor, len(cfgs))
+
+	for name, cfg := range cfgs {
+		if cfg.Type == "cluster" {
+			cfg.Cluster.Warmup = -1
+		}
+
+		ret[name] = cfg
+	}
+
+	return ret
+}
+
+// newPipelines creates a pipeline for the readers in readerIDs, or for every
+// reader when readerIDs is nil, with actions from actionsMap. When until is
+// set, the pipelines process the logs between since and until.
+func newPipelines(
+	logger log.Logger,
+	cfg *config.Config,
+	actionsMap map[string]types.Action,
+	persister types.Persister,
+	m *metrics.Metrics,
+	shared *Shared,
+	readerIDs map[types.ReaderID]struct{},
+	since time.Time,
+	until time.Time,
+) ([]*pipeline.Pipeline, error) {
+	shared.begin(cfg.Actions)
+
+	processorConfigs := cfg.Processors
+
+	if !until.IsZero() {
+		processorConfigs = NoWarmup(processorConfigs)
+	}
+
+	processorsMap, err := NewProcessorsMap(logger, processorConfigs, actionsMap, persister, m, shared)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	ret := make([]*pipeline.Pipeline, len(cfg.Readers))
+	checkpoint := NewCheckpoint(cfg.Persister.Checkpoint)
+	retention := NewRetention(cfg.Persister.Retention)
+	shutdownGrace := NewShutdownGrace(cfg.Shutdown)
+	restart := NewRestart(logger, cfg.Supervisor)
+
+	ret := make([]*pipeline.Pipeline, 0, len(cfg.Readers))
 
 	// errCh := make(chan error, len(cfg.Watchers))
 
-	readerIDs := make(map[types.ReaderID]struct{}, len(cfg.Readers))
+	seen := make(map[types.ReaderID]struct{}, len(cfg.Readers))
 
-	for i, config := range cfg.Readers {
+	for _, config := range cfg.Readers {
 		readerID := config.ReaderID()
 
-		if _, ok := readerIDs[readerID]; ok {
+		if _, ok := seen[readerID]; ok {
 			return nil, errors.Errorf("duplicate reader ID: %q", readerID)
 		}
 
-		readerIDs[readerID] = struct{}{}
+		seen[readerID] = struct{}{}
 
-		newProcessor, err := NewProcessorsFromMap(processorsMap, config.Processors)
+		if !until.IsZero() {
+			config.InitialState = types.State{
+				Timestamp: since,
+			}
+			config.Time.Mode = string(pipeline.TimeModeEvent)
+		}
+
+		newProcessor, err := NewProcessorsFromMap(logger, processorsMap, config.Processors, config.Composition)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 
-		r, err := NewReader(logger, persister, newProcessor, config)
+		if _, ok := readerIDs[readerID]; readerIDs != nil && !ok {
+			continue
+		}
+
+		pline, err := newPipeline(
+			logger, config, newProcessor, persister, m, shared, checkpoint, retention, shutdownGrace, restart, until)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 
-		w := watcher.New(watcher.Params{
-			Persister:    persister,
-			Reader:       r,
-			Logger:       logger,
-			InitialState: config.InitialState,
-		})
+		ret = append(ret, pline)
+	}
 
-		pline := pipeline.New(pipeline.Params{
-			Logger:       logger,
-			Watcher:      w,
-			NewProcessor: newProcessor,
-			BufferSize:   0,
-		})
+	return ret, nil
+}
 
-		ret[i] = pline
+// NewTailPipeline creates a pipeline for the reader that processes the logs
+// from since onwards with the processors created by newProcessor, instead of
+// the configured ones. No state is loaded or persisted.
+func NewTailPipeline(
+	logger log.Logger,
+	cfg *config.Config,
+	readerConfig config.Reader,
+	newProcessor processor.Factory,
+	since time.Time,
+) (*pipeline.Pipeline, error) {
+	readerConfig.InitialState = types.State{
+		Timestamp: since,
 	}
 
-	return ret, nil
+	pline, err := newPipeline(
+		logger,
+		readerConfig,
+		newProcessor,
+		persister.NewNoop(),
+		nil,
+		nil,
+		NewCheckpoint(cfg.Persister.Checkpoint),
+		NewRetention(cfg.Persister.Retention),
+		NewShutdownGrace(cfg.Shutdown),
+		NewRestart(logger, cfg.Supervisor),
+		time.Time{},
+	)
+
+	return pline, errors.Trace(err)
+}
+
+// newPipeline creates the reader, the watcher and the pipeline for the
+// reader config.
+func newPipeline(
+	logger log.Logger,
+	config config.Reader,
+	newProcessor processor.Factory,
+	persister types.Persister,
+	m *metrics.Metrics,
+	shared *Shared,
+	checkpoint watcher.Checkpoint,
+	retention persister.Retention,
+	shutdownGrace time.Duration,
+	restart supervisor.Params,
+	until time.Time,
+) (*pipeline.Pipeline, error) {
+	r, err := NewReader(logger, persister, newProcessor, checkpoint, retention, shutdownGrace, restart, m, shared, config)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	buffer, err := NewBuffer(config.Buffer)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	t, err := NewTime(config.Time)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	w := watcher.New(watcher.Params{
+		Persister:     persister,
+		Reader:        r,
+		Logger:        logger,
+		InitialState:  config.InitialState,
+		Checkpoint:    checkpoint,
+		Clock:         t.Clock,
+		ShutdownGrace: shutdownGrace,
+		Metrics:       m,
+		Until:         until,
+	})
+
+	children, _ := r.(types.ChildHeartbeater)
+
+	return pipeline.New(pipeline.Params{
+		Logger:        logger,
+		Watcher:       w,
+		NewProcessor:  newProcessor,
+		Buffer:        buffer,
+		Time:          t,
+		Persister:     persister,
+		ReaderID:      config.ReaderID(),
+		ShutdownGrace: shutdownGrace,
+		Metrics:       m,
+		Children:      children,
+	}), nil
+}
+
+// NewHealthChecker creates a new health.Checker for the readers run by sup.
+func NewHealthChecker(sup *supervisor.Supervisor, cfg config.Health) *health.Checker {
+	return health.New(health.Params{
+		Supervisor:   sup,
+		StallTimeout: cfg.StallTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+	})
+}
+
+// NewSupervisor creates a new supervisor.Supervisor from config.
+func NewSupervisor(logger log.Logger, cfg config.Supervisor) *supervisor.Supervisor {
+	return supervisor.New(NewRestart(logger, cfg))
 }
@@ -0,0 +1,218 @@
+package factory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessorMatcherPresets(t *testing.T) {
+	type testCase struct {
+		preset string
+		fields types.Fields
+		lines  []string
+		want   [][]string
+	}
+
+	testCases := []testCase{
+		{
+			preset: "golang_panic",
+			lines: []string{
+				"starting server",
+				"panic: runtime error: invalid memory address or nil pointer dereference",
+				"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x47f1a2]",
+				"",
+				"goroutine 1 [running]:",
+				"main.(*Server).Start(0x0)",
+				"\t/app/server.go:12 +0x22",
+				"main.main()",
+				"\t/app/main.go:8 +0x1d",
+				"exit status 2",
+			},
+			want: [][]string{{
+				"panic: runtime error: invalid memory address or nil pointer dereference",
+				"[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x47f1a2]",
+				"",
+				"goroutine 1 [running]:",
+				"main.(*Server).Start(0x0)",
+				"\t/app/server.go:12 +0x22",
+				"main.main()",
+				"\t/app/main.go:8 +0x1d",
+			}},
+		},
+		{
+			preset: "java_exception",
+			lines: []string{
+				"INFO started",
+				`Exception in thread "main" java.lang.IllegalStateException: boom`,
+				"\tat com.example.App.run(App.java:10)",
+				"\tat com.example.App.main(App.java:5)",
+				"Caused by: java.io.IOException: closed",
+				"\t... 2 more",
+				"INFO shutting down",
+			},
+			want: [][]string{{
+				`Exception in thread "main" java.lang.IllegalStateException: boom`,
+				"\tat com.example.App.run(App.java:10)",
+				"\tat com.example.App.main(App.java:5)",
+				"Caused by: java.io.IOException: closed",
+				"\t... 2 more",
+			}},
+		},
+		{
+			preset: "python_traceback",
+			lines: []string{
+				"Traceback (most recent call last):",
+				`  File "/app/main.py", line 3, in <module>`,
+				"    main()",
+				"ValueError: boom",
+				"next line",
+			},
+			want: [][]string{{
+				"Traceback (most recent call last):",
+				`  File "/app/main.py", line 3, in <module>`,
+				"    main()",
+				"ValueError: boom",
+			}},
+		},
+		{
+			preset: "node_unhandled_rejection",
+			lines: []string{
+				"[UnhandledPromiseRejection: This error originated either by throwing inside of an async function without a catch block. The promise rejected with the reason \"boom\".] {",
+				"  code: 'ERR_UNHANDLED_REJECTION'",
+				"}",
+				"listening on :3000",
+			},
+			want: [][]string{{
+				"[UnhandledPromiseRejection: This error originated either by throwing inside of an async function without a catch block. The promise rejected with the reason \"boom\".] {",
+				"  code: 'ERR_UNHANDLED_REJECTION'",
+				"}",
+			}},
+		},
+		{
+			preset: "kernel_oom",
+			lines: []string{
+				"eth0: link up",
+				"Out of memory: Killed process 1234 (java) total-vm:1234kB, anon-rss:1000kB",
+				"Memory cgroup out of memory: Killed process 42 (node) total-vm:10kB",
+			},
+			want: [][]string{
+				{"Out of memory: Killed process 1234 (java) total-vm:1234kB, anon-rss:1000kB"},
+				{"Memory cgroup out of memory: Killed process 42 (node) total-vm:10kB"},
+			},
+		},
+		{
+			preset: "segfault",
+			lines: []string{
+				"app[1234]: segfault at 0 ip 000055d0c0a0b0c0 sp 00007ffd1c2d3e40 error 4 in app[55d0c0a00000+10000]",
+				"all good",
+				"app.service: Main process exited, code=dumped, status=11/SEGV",
+			},
+			want: [][]string{
+				{"app[1234]: segfault at 0 ip 000055d0c0a0b0c0 sp 00007ffd1c2d3e40 error 4 in app[55d0c0a00000+10000]"},
+				{"app.service: Main process exited, code=dumped, status=11/SEGV"},
+			},
+		},
+		{
+			preset: "systemd_unit_failure",
+			fields: types.Fields{
+				"SYSLOG_IDENTIFIER": "systemd",
+			},
+			lines: []string{
+				"Started app.service.",
+				"app.service: Failed with result 'exit-code'.",
+				"Failed to start App Service.",
+			},
+			want: [][]string{
+				{"app.service: Failed with result 'exit-code'."},
+				{"Failed to start App Service."},
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.preset, func(t *testing.T) {
+			action := mock.NewAction()
+
+			proc, err := factory.NewProcessor(config.Processor{
+				Type:   "matcher",
+				Action: "action",
+				Matcher: config.ProcessorMatcher{
+					Preset: tc.preset,
+				},
+			}, map[string]types.Action{
+				"action": action,
+			})
+			require.NoError(t, err)
+
+			now := time.Now()
+
+			for _, line := range tc.lines {
+				err := proc.ProcessMessage(ctx, types.NewMessage(now, "test", line, tc.fields))
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, proc.Tick(ctx, now))
+
+			assert.Equal(t, tc.want, action.Texts())
+		})
+	}
+}
+
+func TestProcessorMatcherPresets_all(t *testing.T) {
+	for _, name := range config.ProcessorMatcherPresetNames() {
+		_, err := factory.NewProcessor(config.Processor{
+			Type:   "matcher",
+			Action: "action",
+			Matcher: config.ProcessorMatcher{
+				Preset: name,
+			},
+		}, map[string]types.Action{
+			"action": mock.NewAction(),
+		})
+		assert.NoError(t, err, "preset: %s", name)
+	}
+}
+
+func TestProcessorMatcherPresets_unknown(t *testing.T) {
+	_, err := factory.NewProcessor(config.Processor{
+		Type:   "matcher",
+		Action: "action",
+		Matcher: config.ProcessorMatcher{
+			Preset: "nope",
+		},
+	}, map[string]types.Action{
+		"action": mock.NewAction(),
+	})
+	assert.EqualError(t, err, `unknown matcher preset: "nope"`)
+}
+
+func TestProcessorMatcherPresets_includeEnd(t *testing.T) {
+	includeEnd := false
+
+	cfg, err := config.ProcessorMatcher{
+		Preset:     "python_traceback",
+		IncludeEnd: &includeEnd,
+	}.Expand()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.IncludeEnd)
+	assert.False(t, *cfg.IncludeEnd)
+
+	cfg, err = config.ProcessorMatcher{
+		Preset: "python_traceback",
+	}.Expand()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.IncludeEnd)
+	assert.True(t, *cfg.IncludeEnd)
+}
@@ -0,0 +1,73 @@
+package factory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProcessor_whenAndActions(t *testing.T) {
+	ctx := context.Background()
+
+	logAction := mock.NewAction()
+	notifyAction := mock.NewAction()
+
+	proc, err := factory.NewProcessor(config.Processor{
+		Type: "any",
+		When: &config.Matcher{
+			Type: "expr",
+			Expr: `(not (substring "debug"))`,
+		},
+		Actions: []config.ProcessorAction{
+			{
+				Action: "log",
+			},
+			{
+				Action: "notify",
+				Matcher: &config.Matcher{
+					Type: "expr",
+					Expr: `(field "PRIORITY" "^[0-3]$")`,
+				},
+			},
+		},
+	}, map[string]types.Action{
+		"log":    logAction,
+		"notify": notifyAction,
+	})
+	require.NoError(t, err)
+
+	process := func(text string, priority string) {
+		err := proc.ProcessMessage(ctx, types.NewMessage(time.Now(), "test", text, types.Fields{
+			"PRIORITY": priority,
+		}))
+		require.NoError(t, err)
+	}
+
+	process("info", "6")
+	process("debug", "7")
+	process("error", "3")
+	process("debug error", "3")
+
+	assert.Equal(t, [][]string{{"info"}, {"error"}}, logAction.Texts())
+	assert.Equal(t, [][]string{{"error"}}, notifyAction.Texts())
+}
+
+func TestNewProcessor_actionAndActions(t *testing.T) {
+	_, err := factory.NewProcessor(config.Processor{
+		Type:   "any",
+		Action: "log",
+		Actions: []config.ProcessorAction{
+			{Action: "log"},
+		},
+	}, map[string]types.Action{
+		"log": mock.NewAction(),
+	})
+	assert.EqualError(t, err, "action and actions are mutually exclusive")
+}
@@ -0,0 +1,148 @@
+package factory
+
+import (
+	"sync"
+
+	"github.com/docker/docker/client"
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Shared keeps the instances that should be shared by all readers across
+// config reloads: the processors that keep state for all readers, such as
+// cluster and redact, and the docker client. A shared processor is reused
+// as long as its config and the actions do not change, so that a single
+// instance persists its state. A nil *Shared creates new instances every
+// time.
+type Shared struct {
+	mu         sync.Mutex
+	processors map[string]sharedProcessor
+	pending    map[string]sharedProcessor
+	actions    map[string]config.Action // actions of the current build.
+	docker     *client.Client
+}
+
+// sharedProcessor is a shared processor with the fingerprint of the config
+// it was created from.
+type sharedProcessor struct {
+	fingerprint string
+	processor   types.Processor
+}
+
+// sharedFingerprint contains the configuration covered by the fingerprint
+// of a shared processor.
+type sharedFingerprint struct {
+	Processor config.Processor         `yaml:"processor"`
+	Actions   map[string]config.Action `yaml:"actions"`
+}
+
+// NewShared creates a new instance of Shared.
+func NewShared() *Shared {
+	return &Shared{
+		processors: map[string]sharedProcessor{},
+	}
+}
+
+// begin starts a new build of the processors with the actions configured by
+// actions.
+func (s *Shared) begin(actions map[string]config.Action) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = map[string]sharedProcessor{}
+	s.actions = actions
+}
+
+// Commit keeps the shared processors used by the last build, and drops the
+// others. It should be called once the pipelines of the build are running,
+// so that the instances of a rejected config are not reused.
+func (s *Shared) Commit() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		s.processors = s.pending
+		s.pending = nil
+	}
+}
+
+// processor returns the shared processor name created from cfg, and calls
+// create when there is none for the current config and actions.
+func (s *Shared) processor(
+	name string,
+	cfg config.Processor,
+	create func() (types.Processor, error),
+) (types.Processor, error) {
+	if s == nil {
+		proc, err := create()
+
+		return proc, errors.Trace(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := yaml.Marshal(sharedFingerprint{
+		Processor: cfg,
+		Actions:   s.actions,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	fingerprint := string(data)
+
+	if s.pending == nil {
+		s.pending = map[string]sharedProcessor{}
+	}
+
+	entry, ok := s.processors[name]
+	if !ok || entry.fingerprint != fingerprint {
+		proc, err := create()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		entry = sharedProcessor{
+			fingerprint: fingerprint,
+			processor:   proc,
+		}
+	}
+
+	s.pending[name] = entry
+
+	return entry.processor, nil
+}
+
+// dockerClient returns the docker client, creating it upon the first call.
+func (s *Shared) dockerClient() (*client.Client, error) {
+	if s == nil {
+		cl, err := client.NewClientWithOpts(client.FromEnv)
+
+		return cl, errors.Trace(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.docker == nil {
+		cl, err := client.NewClientWithOpts(client.FromEnv)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		s.docker = cl
+	}
+
+	return s.docker, nil
+}
@@ -0,0 +1,56 @@
+package factory_test
+
+import (
+	"testing"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShared(t *testing.T) {
+	shared := factory.NewShared()
+
+	actionsMap := map[string]types.Action{
+		"action": mock.NewAction(),
+	}
+
+	newCluster := func(t *testing.T, similarity float64) types.Processor {
+		t.Helper()
+
+		processorsMap, err := factory.NewProcessorsMap(log.New(), map[string]config.Processor{
+			"cluster": {
+				Type:    "cluster",
+				Action:  "action",
+				Cluster: config.ProcessorCluster{Similarity: similarity},
+			},
+		}, actionsMap, persister.NewNoop(), nil, shared)
+		require.NoError(t, err)
+
+		proc, err := processorsMap["cluster"]()
+		require.NoError(t, err)
+
+		return proc
+	}
+
+	first := newCluster(t, 0.5)
+	shared.Commit()
+
+	assert.Same(t, first, newCluster(t, 0.5), "unchanged config should reuse the instance")
+
+	// The instance of a build that is not committed is not reused.
+	assert.NotSame(t, first, newCluster(t, 0.6), "changed config should create a new instance")
+	assert.Same(t, first, newCluster(t, 0.5), "rejected build should not replace the instance")
+	shared.Commit()
+
+	changed := newCluster(t, 0.6)
+	shared.Commit()
+
+	assert.NotSame(t, first, changed)
+	assert.Same(t, changed, newCluster(t, 0.6))
+}
@@ -0,0 +1,35 @@
+package factory
+
+// Types supported by the factory. They are also used by Validate, so a type
+// must be added to the list together with its constructor.
+var (
+	ActionTypes        = []string{"log", "notify"}
+	NotifyServiceTypes = []string{"slack", "telegram"}
+	ProcessorTypes     = []string{"any", "cluster", "matcher", "rate", "redact", "sequence", "transform"}
+	CompositionTypes   = []string{"", "isolated", "parallel", "serial"}
+	ReaderTypes        = []string{"docker", "journald"}
+	PersisterTypes     = []string{"bolt", "file", "noop"}
+)
+
+// isKnownType returns true when t is one of knownTypes.
+func isKnownType(knownTypes []string, t string) bool {
+	for _, knownType := range knownTypes {
+		if knownType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processorHasAction returns true when the processors of type t perform an
+// action. Transform and redact processors only modify messages for the
+// subsequent processors.
+func processorHasAction(t string) bool {
+	switch t {
+	case "transform", "redact":
+		return false
+	default:
+		return true
+	}
+}
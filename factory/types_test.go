@@ -0,0 +1,81 @@
+package factory_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertKnown fails when err reports t as an unknown type.
+func assertKnown(t *testing.T, err error, kind string, typ string) {
+	t.Helper()
+
+	if err != nil {
+		assert.False(t, strings.Contains(err.Error(), "unknown "+kind),
+			"%s %q not handled by the factory: %s", kind, typ, err)
+	}
+}
+
+func TestTypes(t *testing.T) {
+	logger := log.New()
+
+	actionsMap := map[string]types.Action{
+		"action": mock.NewAction(),
+	}
+
+	for _, typ := range factory.ActionTypes {
+		_, err := factory.NewAction(logger, config.Action{Type: typ})
+		assertKnown(t, err, "action", typ)
+	}
+
+	for _, typ := range factory.ProcessorTypes {
+		processorsMap, err := factory.NewProcessorsMap(logger, map[string]config.Processor{
+			"proc": {
+				Type:   typ,
+				Action: "action",
+			},
+		}, actionsMap, persister.NewNoop(), nil, nil)
+
+		if err == nil {
+			_, err = processorsMap["proc"]()
+		}
+
+		assertKnown(t, err, "processor", typ)
+	}
+
+	for _, typ := range factory.CompositionTypes {
+		_, err := factory.NewProcessorsFromMap(logger, nil, nil, config.Composition{Type: typ})
+		assertKnown(t, err, "composition", typ)
+	}
+
+	for _, typ := range factory.PersisterTypes {
+		dir := t.TempDir()
+
+		p, err := factory.NewPersister(config.Persister{
+			Type: typ,
+			File: config.PersisterFile{Dir: dir},
+			Bolt: config.PersisterBolt{Path: filepath.Join(dir, "state.db")},
+		})
+		assertKnown(t, err, "persister", typ)
+
+		if closer, ok := p.(interface{ Close() error }); ok {
+			require.NoError(t, closer.Close())
+		}
+	}
+
+	for _, typ := range factory.ReaderTypes {
+		_, err := factory.NewReader(logger, persister.NewNoop(), nil, factory.NewCheckpoint(config.Checkpoint{}),
+			factory.NewRetention(config.Retention{}), 0, factory.NewRestart(logger, config.Supervisor{}), nil, nil,
+			config.Reader{Type: typ})
+		assert.NoError(t, err, "reader %q", typ)
+	}
+}
@@ -0,0 +1,276 @@
+package factory
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/jeremija/taily/action"
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// ValidateYAML decodes the YAML config strictly and validates it. All
+// problems found are returned with their lines, sorted.
+func ValidateYAML(data []byte) []config.Problem {
+	cfg, doc, problems := config.DecodeStrict(data)
+	if cfg == nil {
+		return problems
+	}
+
+	for _, problem := range Validate(cfg) {
+		problem.Line = doc.Line(problem.Path)
+		problems = append(problems, problem)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems
+}
+
+// Validate checks the actions, processors and readers in cfg, including the
+// references between them, and compiles all matchers and templates. Unlike
+// NewPipelines, it does not stop at the first problem, and it does not
+// create the readers, the persister or the notify services, so it can be
+// run anywhere.
+func Validate(cfg *config.Config) []config.Problem {
+	v := &validator{}
+
+	actionNames := make([]string, 0, len(cfg.Actions))
+
+	for name := range cfg.Actions {
+		actionNames = append(actionNames, name)
+	}
+
+	sort.Strings(actionNames)
+
+	for _, name := range actionNames {
+		v.action(cfg.Actions[name], "actions", name)
+	}
+
+	processorNames := make([]string, 0, len(cfg.Processors))
+
+	for name := range cfg.Processors {
+		processorNames = append(processorNames, name)
+	}
+
+	sort.Strings(processorNames)
+
+	for _, name := range processorNames {
+		v.processor(cfg, name, "processors", name)
+	}
+
+	readerIDs := make(map[types.ReaderID]struct{}, len(cfg.Readers))
+
+	for i, readerConfig := range cfg.Readers {
+		path := []string{"readers", strconv.Itoa(i)}
+
+		readerID := readerConfig.ReaderID()
+
+		if _, ok := readerIDs[readerID]; ok {
+			v.check(errors.Errorf("duplicate reader ID: %q", readerID), path, "id")
+		}
+
+		readerIDs[readerID] = struct{}{}
+
+		v.reader(cfg, readerConfig, path...)
+	}
+
+	if !isKnownType(PersisterTypes, cfg.Persister.Type) {
+		v.check(errors.Errorf("unknown persister: %q", cfg.Persister.Type), []string{"persister"}, "type")
+	}
+
+	return v.problems
+}
+
+// validator collects the problems found by Validate.
+type validator struct {
+	problems []config.Problem
+}
+
+// check records err, when set, as a problem of the value at path followed
+// by elems. It returns true when err is nil.
+func (v *validator) check(err error, path []string, elems ...string) bool {
+	if err == nil {
+		return true
+	}
+
+	p := make([]string, 0, len(path)+len(elems))
+	p = append(p, path...)
+	p = append(p, elems...)
+
+	v.problems = append(v.problems, config.Problem{
+		Path: p,
+		Err:  err,
+	})
+
+	return false
+}
+
+// action validates the action config at path.
+func (v *validator) action(cfg config.Action, path ...string) {
+	format := func(cfg config.Format, elems ...string) {
+		_, err := NewFormatter(cfg)
+		v.check(err, path, elems...)
+	}
+
+	if !isKnownType(ActionTypes, cfg.Type) {
+		v.check(errors.Errorf("unknown action: %q", cfg.Type), path, "type")
+
+		return
+	}
+
+	switch cfg.Type {
+	case "log":
+		format(cfg.Log.Format, "log", "format")
+	case "notify":
+		format(cfg.Notify.TitleFormat, "notify", "title_format")
+		format(cfg.Notify.BodyFormat, "notify", "body_format")
+
+		// The services are not created because some of them connect to their
+		// APIs.
+		for i, service := range cfg.Notify.Services {
+			if !isKnownType(NotifyServiceTypes, service.Type) {
+				err := errors.Errorf("unknown notify service: %q", service.Type)
+				v.check(err, path, "notify", "services", strconv.Itoa(i), "type")
+			}
+		}
+	}
+}
+
+// processor validates the config of the named processor at path.
+func (v *validator) processor(cfg *config.Config, name string, path ...string) {
+	procConfig := cfg.Processors[name]
+
+	if !isKnownType(ProcessorTypes, procConfig.Type) {
+		v.check(errors.Errorf("unknown processor: %q", procConfig.Type), path, "type")
+
+		return
+	}
+
+	ok := true
+
+	if procConfig.When != nil {
+		_, err := NewMatcher(procConfig.When)
+		ok = v.check(err, path, "when") && ok
+	}
+
+	// Placeholders for the configured actions, so that the processors can be
+	// created without creating the actions.
+	actionsMap := make(map[string]types.Action, len(cfg.Actions))
+
+	for actionName := range cfg.Actions {
+		actionsMap[actionName] = action.Multi{}
+	}
+
+	if processorHasAction(procConfig.Type) {
+		ok = v.processorActions(procConfig, actionsMap, path...) && ok
+	}
+
+	if !ok {
+		// Creating the processor would report the same problems again.
+		return
+	}
+
+	var err error
+
+	switch procConfig.Type {
+	case "cluster":
+		_, err = NewProcessorCluster(name, procConfig, actionsMap, persister.NewNoop(), nil)
+	case "redact":
+		_, err = NewProcessorRedact(log.New(), procConfig.Redact)
+	default:
+		_, err = NewProcessor(procConfig, actionsMap)
+	}
+
+	if procConfig.Type == "any" {
+		v.check(err, path)
+	} else {
+		v.check(err, path, procConfig.Type)
+	}
+}
+
+// processorActions validates the action references of the processor config
+// at path. It returns true when there are no problems.
+func (v *validator) processorActions(cfg config.Processor, actionsMap map[string]types.Action, path ...string) bool {
+	undefined := func(name string) error {
+		if _, ok := actionsMap[name]; ok {
+			return nil
+		}
+
+		if name == "" {
+			return errors.Errorf("action is required")
+		}
+
+		return errors.Errorf("undefined action: %q", name)
+	}
+
+	if len(cfg.Actions) == 0 {
+		return v.check(undefined(cfg.Action), path, "action")
+	}
+
+	ok := true
+
+	if cfg.Action != "" {
+		ok = v.check(errors.Errorf("action and actions are mutually exclusive"), path, "action")
+	}
+
+	for i, actionConfig := range cfg.Actions {
+		index := strconv.Itoa(i)
+
+		ok = v.check(undefined(actionConfig.Action), path, "actions", index, "action") && ok
+
+		if actionConfig.Matcher != nil {
+			_, err := NewMatcher(actionConfig.Matcher)
+			ok = v.check(err, path, "actions", index, "matcher") && ok
+		}
+	}
+
+	return ok
+}
+
+// reader validates the reader config at path.
+func (v *validator) reader(cfg *config.Config, readerConfig config.Reader, path ...string) {
+	if !isKnownType(ReaderTypes, readerConfig.Type) {
+		v.check(errors.Errorf("unknown reader: %q", readerConfig.Type), path, "type")
+	}
+
+	// The processors listed before a redact processor receive the original
+	// messages, except in the parallel composition, which applies all
+	// transformers first.
+	var unredacted string
+
+	for i, name := range readerConfig.Processors {
+		procConfig, ok := cfg.Processors[name]
+		if !ok {
+			err := errors.Errorf("processor configuration not found: %q", name)
+			v.check(err, path, "processors", strconv.Itoa(i))
+
+			continue
+		}
+
+		switch {
+		case readerConfig.Composition.Type == "parallel":
+		case procConfig.Type == "redact" && unredacted != "":
+			err := errors.Errorf("redact processor %q is listed after %q, which receives unredacted messages", name, unredacted)
+			v.check(err, path, "processors", strconv.Itoa(i))
+		case unredacted == "" && processorHasAction(procConfig.Type):
+			unredacted = name
+		}
+	}
+
+	if !isKnownType(CompositionTypes, readerConfig.Composition.Type) {
+		err := errors.Errorf("unknown composition: %q", readerConfig.Composition.Type)
+		v.check(err, path, "composition", "type")
+	}
+
+	_, err := NewBuffer(readerConfig.Buffer)
+	v.check(err, path, "buffer")
+
+	_, err = NewTime(readerConfig.Time)
+	v.check(err, path, "time")
+}
@@ -0,0 +1,190 @@
+package factory_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jeremija/taily/factory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateYAML(t *testing.T) {
+	type testCase struct {
+		name string
+		yaml string
+		want []string
+	}
+
+	testCases := []testCase{
+		{
+			name: "valid",
+			yaml: `
+actions:
+  log:
+    type: log
+    log:
+      format:
+        type: plain
+processors:
+  errors:
+    type: matcher
+    action: log
+    matcher:
+      preset: golang_panic
+  scrub:
+    type: redact
+    redact:
+      builtin:
+        - all
+readers:
+  - type: journald
+    processors:
+      - scrub
+      - errors
+persister:
+  type: noop
+`,
+		},
+		{
+			name: "problems",
+			yaml: `
+actions:
+  log:
+    type: log
+    log:
+      format:
+        type: template
+        template:
+          format: '{unclosed'
+processors:
+  errors:
+    type: matcher
+    action: lg
+    when:
+      type: not
+    matcher:
+      start_line:
+        type: substring
+        substring: error
+  sequence:
+    type: sequence
+    action: log
+    sequence:
+      window: 1m
+      steps:
+        - matcher:
+            type: expr
+            expr: '(bogus "a")'
+        - matcher:
+            type: any
+readers:
+  - type: journald
+    procesors:
+      - errors
+  - type: journald
+    processors:
+      - erors
+    buffer:
+      overload: explode
+persister:
+  type: noop
+`,
+			want: []string{
+				`6: actions.log.log.format: unclosed template at position: 0`,
+				`13: processors.errors.action: undefined action: "lg"`,
+				`14: processors.errors.when: matcher is required`,
+				`23: processors.sequence.sequence: [1:6] function: bogus: unfamiliar function: bogus`,
+				`33: field procesors not found in type config.Reader`,
+				`35: readers.1.id: duplicate reader ID: "journald"`,
+				`37: readers.1.processors.0: processor configuration not found: "erors"`,
+				`38: readers.1.buffer: unknown overload policy: "explode"`,
+			},
+		},
+		{
+			name: "transform",
+			yaml: `
+processors:
+  fields:
+    type: transform
+    transform:
+      operations:
+        - type: rename
+          field: unit
+        - type: copy
+          from: _SYSTEMD_UNIT
+persister:
+  type: noop
+`,
+			want: []string{
+				`5: processors.fields.transform: transform operation 0: from is required for rename`,
+			},
+		},
+		{
+			name: "redact order",
+			yaml: `
+actions:
+  log:
+    type: log
+    log:
+      format:
+        type: plain
+processors:
+  errors:
+    type: any
+    action: log
+  scrub:
+    type: redact
+    redact:
+      builtin:
+        - all
+readers:
+  - type: journald
+    processors:
+      - errors
+      - scrub
+  - id: parallel
+    type: journald
+    processors:
+      - errors
+      - scrub
+    composition:
+      type: parallel
+persister:
+  type: noop
+`,
+			want: []string{
+				`21: readers.0.processors.1: redact processor "scrub" is listed after "errors", which receives unredacted messages`,
+			},
+		},
+		{
+			name: "syntax error",
+			yaml: "readers:\n  - type: journald\n bad",
+			want: []string{
+				`2: did not find expected key`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+
+			for _, problem := range factory.ValidateYAML([]byte(tc.yaml)) {
+				got = append(got, fmt.Sprintf("%d: %s", problem.Line, problem))
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestValidateYAML_sampleConfig(t *testing.T) {
+	data, err := os.ReadFile("../config.yml")
+	require.NoError(t, err)
+
+	assert.Empty(t, factory.ValidateYAML(data))
+}
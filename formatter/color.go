@@ -0,0 +1,81 @@
+package formatter
+
+import (
+	"bytes"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// ANSI escape sequences used by Color.
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorGray   = "\x1b[90m"
+	colorReset  = "\x1b[0m"
+)
+
+// Color wraps a Formatter and colorizes its output with ANSI escape
+// sequences, based on the journald PRIORITY field: errors are red, warnings
+// are yellow and debug messages are gray. Messages read from stderr without
+// a priority are yellow.
+type Color struct {
+	formatter types.Formatter
+}
+
+// NewColor creates a new instance of Color.
+func NewColor(formatter types.Formatter) Color {
+	return Color{
+		formatter: formatter,
+	}
+}
+
+// Assert that Color implements types.Formatter.
+var _ types.Formatter = Color{}
+
+// Format implements Formatter.
+func (f Color) Format(buf *bytes.Buffer, message types.Message) error {
+	start := buf.Len()
+
+	if err := f.formatter.Format(buf, message); err != nil {
+		return errors.Trace(err)
+	}
+
+	color := messageColor(message)
+	if color == "" {
+		return nil
+	}
+
+	formatted := append([]byte(nil), buf.Bytes()[start:]...)
+	buf.Truncate(start)
+
+	// The reset goes before the trailing newline so that the color does not
+	// leak to the next line.
+	text := bytes.TrimRight(formatted, "\n")
+
+	buf.WriteString(color)
+	buf.Write(text)
+	buf.WriteString(colorReset)
+	buf.Write(formatted[len(text):])
+
+	return nil
+}
+
+// messageColor returns the escape sequence for message, or an empty string
+// when it should not be colorized.
+func messageColor(message types.Message) string {
+	switch message.Fields["PRIORITY"] {
+	case "0", "1", "2", "3":
+		return colorRed
+	case "4":
+		return colorYellow
+	case "7":
+		return colorGray
+	case "":
+		if message.Source == types.SourceStderr {
+			return colorYellow
+		}
+	}
+
+	return ""
+}
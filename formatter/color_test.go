@@ -0,0 +1,59 @@
+package formatter_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/formatter"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColor(t *testing.T) {
+	type testCase struct {
+		fields types.Fields
+		source types.Source
+		want   string
+	}
+
+	testCases := []testCase{
+		{
+			fields: types.Fields{"PRIORITY": "3"},
+			want:   "\x1b[31mtest\x1b[0m\n",
+		},
+		{
+			fields: types.Fields{"PRIORITY": "4"},
+			want:   "\x1b[33mtest\x1b[0m\n",
+		},
+		{
+			fields: types.Fields{"PRIORITY": "6"},
+			want:   "test\n",
+		},
+		{
+			fields: types.Fields{"PRIORITY": "7"},
+			want:   "\x1b[90mtest\x1b[0m\n",
+		},
+		{
+			source: types.SourceStderr,
+			want:   "\x1b[33mtest\x1b[0m\n",
+		},
+		{
+			source: types.SourceStdout,
+			want:   "test\n",
+		},
+	}
+
+	f := formatter.NewColor(formatter.NewPlain())
+
+	for i, tc := range testCases {
+		message := types.NewMessage(time.Time{}, "test", "test", tc.fields)
+		message.Source = tc.source
+
+		buf := bytes.NewBufferString("prefix\n")
+
+		require.NoError(t, f.Format(buf, message), "test case: %d", i)
+		assert.Equal(t, "prefix\n"+tc.want, buf.String(), "test case: %d", i)
+	}
+}
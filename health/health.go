@@ -0,0 +1,229 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jeremija/taily/clock"
+	"github.com/jeremija/taily/supervisor"
+	"github.com/jeremija/taily/types"
+)
+
+// Defaults for Params.
+const (
+	DefaultStallTimeout = time.Minute
+	DefaultReadTimeout  = 5 * time.Minute
+)
+
+// Checker checks the health of the readers run by a supervisor.Supervisor.
+//
+// A reader is live unless it is running but has not sent a heartbeat for
+// StallTimeout, which means that its processing is stuck. The same applies to
+// the pipelines run by the reader itself, e.g. per docker container. Since
+// the heartbeat is also sent by the ticks, a reader that reports its progress
+// is also not live when it has not done so for ReadTimeout, which means that
+// the reading is stuck. Readers waiting to be restarted are live since the
+// supervisor restarts them. A reader is ready when it is live and running, or
+// when it has completed.
+type Checker struct {
+	params Params
+}
+
+// Params contains parameters for New.
+type Params struct {
+	Supervisor *supervisor.Supervisor // Supervisor to check the readers of.
+	Clock      types.Clock            // Clock to use. Defaults to the system clock.
+	// StallTimeout is the time after which a running reader without a
+	// heartbeat is considered stuck. It should be larger than the duration of
+	// the slowest action. Defaults to DefaultStallTimeout.
+	StallTimeout time.Duration
+	// ReadTimeout is the time after which a running reader that has not
+	// reported progress is considered stuck, see
+	// supervisor.ProgressReporter. Readers report progress at least every
+	// minute even when there are no messages to read. Defaults to
+	// DefaultReadTimeout.
+	ReadTimeout time.Duration
+}
+
+// Report describes the health of all readers.
+type Report struct {
+	Live    bool     `json:"live"`    // Live is true when all readers are live.
+	Ready   bool     `json:"ready"`   // Ready is true when all readers are ready.
+	Started bool     `json:"started"` // Started is true when all readers were started.
+	Readers []Reader `json:"readers"`
+}
+
+// Reader describes the health of a reader.
+type Reader struct {
+	supervisor.Status
+	Live   bool   `json:"live"`
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"` // Reason describes why the reader is not ready.
+}
+
+// New creates a new instance of Checker.
+func New(params Params) *Checker {
+	if params.Clock == nil {
+		params.Clock = clock.New()
+	}
+
+	if params.StallTimeout <= 0 {
+		params.StallTimeout = DefaultStallTimeout
+	}
+
+	if params.ReadTimeout <= 0 {
+		params.ReadTimeout = DefaultReadTimeout
+	}
+
+	return &Checker{
+		params: params,
+	}
+}
+
+// Check returns the current health of all readers.
+func (c *Checker) Check() Report {
+	now := c.params.Clock.Now()
+
+	report := Report{
+		Live:    true,
+		Ready:   true,
+		Started: true,
+	}
+
+	for _, status := range c.params.Supervisor.Status() {
+		reader := c.check(now, status)
+
+		report.Live = report.Live && reader.Live
+		report.Ready = report.Ready && reader.Ready
+		report.Started = report.Started && status.State != supervisor.StateStopped
+		report.Readers = append(report.Readers, reader)
+	}
+
+	return report
+}
+
+// check returns the health of a single reader.
+func (c *Checker) check(now time.Time, status supervisor.Status) Reader {
+	reader := Reader{
+		Status: status,
+		Live:   true,
+	}
+
+	switch status.State {
+	case supervisor.StateRunning:
+		// The heartbeat might still be from before a restart.
+		last := status.Heartbeat
+		if last.Before(status.Since) {
+			last = status.Since
+		}
+
+		if d := now.Sub(last); d > c.params.StallTimeout {
+			reader.Live = false
+			reader.Reason = fmt.Sprintf("no heartbeat for %s", d.Truncate(time.Second))
+
+			return reader
+		}
+
+		if reason := c.checkProgress(now, status); reason != "" {
+			reader.Live = false
+			reader.Reason = reason
+
+			return reader
+		}
+
+		if reason := c.checkChildren(now, status.Children); reason != "" {
+			reader.Live = false
+			reader.Reason = reason
+
+			return reader
+		}
+
+		reader.Ready = true
+	case supervisor.StateCompleted:
+		reader.Ready = true
+	case supervisor.StateBackoff:
+		reader.Reason = "restarting after error: " + status.LastError
+	case supervisor.StateStopped:
+		reader.Reason = "stopped"
+	}
+
+	return reader
+}
+
+// checkProgress returns the reason why the reading is stuck, or an empty
+// string when it is not or when the reader does not report its progress.
+func (c *Checker) checkProgress(now time.Time, status supervisor.Status) string {
+	if status.Progress.IsZero() {
+		return ""
+	}
+
+	// The progress might still be from before a restart.
+	last := status.Progress
+	if last.Before(status.Since) {
+		last = status.Since
+	}
+
+	if d := now.Sub(last); d > c.params.ReadTimeout {
+		return fmt.Sprintf("no progress from reader for %s", d.Truncate(time.Second))
+	}
+
+	return ""
+}
+
+// checkChildren returns the reason why one of the child pipelines is stuck,
+// or an empty string when none is.
+func (c *Checker) checkChildren(now time.Time, children map[types.ReaderID]time.Time) string {
+	readerIDs := make([]types.ReaderID, 0, len(children))
+
+	for readerID := range children {
+		readerIDs = append(readerIDs, readerID)
+	}
+
+	sort.Slice(readerIDs, func(i, j int) bool {
+		return readerIDs[i] < readerIDs[j]
+	})
+
+	for _, readerID := range readerIDs {
+		if d := now.Sub(children[readerID]); d > c.params.StallTimeout {
+			return fmt.Sprintf("%s: no heartbeat for %s", readerID, d.Truncate(time.Second))
+		}
+	}
+
+	return ""
+}
+
+// LiveHandler returns an HTTP handler that responds with the Report and
+// status 200 when all readers are live, or 503 otherwise.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check()
+
+		writeReport(w, report, report.Live)
+	})
+}
+
+// ReadyHandler returns an HTTP handler that responds with the Report and
+// status 200 when all readers are ready, or 503 otherwise.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Check()
+
+		writeReport(w, report, report.Ready)
+	})
+}
+
+// writeReport writes the report as JSON.
+func writeReport(w http.ResponseWriter, report Report, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(report)
+}
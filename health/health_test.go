@@ -0,0 +1,268 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/health"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/supervisor"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type runner struct {
+	readerID  types.ReaderID
+	err       error
+	heartbeat func() time.Time
+	children  map[types.ReaderID]time.Time
+}
+
+func (r *runner) ReaderID() types.ReaderID {
+	return r.readerID
+}
+
+func (r *runner) ProcessPipeline(ctx context.Context) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	<-ctx.Done()
+
+	return errors.Trace(ctx.Err())
+}
+
+func (r *runner) Heartbeat() time.Time {
+	return r.heartbeat()
+}
+
+func (r *runner) ChildHeartbeats() map[types.ReaderID]time.Time {
+	return r.children
+}
+
+func TestChecker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := mock.NewClock(time.Now())
+
+	sup := supervisor.New(supervisor.Params{
+		Logger:     log.New(),
+		MinBackoff: time.Hour,
+	})
+
+	start := clock.Now()
+
+	sup.Add(&runner{
+		readerID:  "active",
+		heartbeat: clock.Now,
+	})
+
+	stuck := &runner{
+		readerID: "stuck",
+		heartbeat: func() time.Time {
+			return start
+		},
+	}
+
+	sup.Add(stuck)
+
+	checker := health.New(health.Params{
+		Supervisor:   sup,
+		Clock:        clock,
+		StallTimeout: time.Minute,
+	})
+
+	report := checker.Check()
+	assert.True(t, report.Live)
+	assert.False(t, report.Ready)
+	assert.False(t, report.Started)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- sup.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return checker.Check().Ready
+	}, time.Second, time.Millisecond)
+
+	report = checker.Check()
+	assert.True(t, report.Live)
+	assert.True(t, report.Started)
+
+	clock.Add(2 * time.Minute)
+
+	report = checker.Check()
+	assert.False(t, report.Live)
+	assert.False(t, report.Ready)
+	require.Len(t, report.Readers, 2)
+	assert.True(t, report.Readers[0].Live)
+	assert.False(t, report.Readers[1].Live)
+	assert.Contains(t, report.Readers[1].Reason, "no heartbeat for")
+
+	w := httptest.NewRecorder()
+	checker.LiveHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var got health.Report
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, types.ReaderID("stuck"), got.Readers[1].ReaderID)
+	assert.False(t, got.Readers[1].Live)
+
+	require.NoError(t, sup.Remove("stuck"))
+
+	sup.Add(&runner{
+		readerID: "failing",
+		err:      errors.New("test"),
+		heartbeat: func() time.Time {
+			return start
+		},
+	})
+
+	require.Eventually(t, func() bool {
+		status := sup.Status()
+
+		return len(status) == 2 && status[1].State == supervisor.StateBackoff
+	}, time.Second, time.Millisecond)
+
+	report = checker.Check()
+	assert.True(t, report.Live)
+	assert.False(t, report.Ready)
+	assert.Equal(t, "restarting after error: test", report.Readers[1].Reason)
+
+	w = httptest.NewRecorder()
+	checker.LiveHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	checker.ReadyHandler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	cancel()
+
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+func TestChecker_children(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := mock.NewClock(time.Now())
+
+	sup := supervisor.New(supervisor.Params{
+		Logger: log.New(),
+	})
+
+	// The reader itself is active, while one of its containers is stuck.
+	sup.Add(&runner{
+		readerID:  "docker",
+		heartbeat: clock.Now,
+		children: map[types.ReaderID]time.Time{
+			"docker:active": clock.Now().Add(2 * time.Minute),
+			"docker:stuck":  clock.Now(),
+		},
+	})
+
+	checker := health.New(health.Params{
+		Supervisor:   sup,
+		Clock:        clock,
+		StallTimeout: time.Minute,
+	})
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- sup.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return checker.Check().Ready
+	}, time.Second, time.Millisecond)
+
+	clock.Add(2 * time.Minute)
+
+	report := checker.Check()
+	assert.False(t, report.Live)
+	require.Len(t, report.Readers, 1)
+	assert.Equal(t, "docker:stuck: no heartbeat for 2m0s", report.Readers[0].Reason)
+	assert.Len(t, report.Readers[0].Children, 2)
+
+	cancel()
+
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
+
+// readingRunner is a runner that reports the progress of its reader.
+type readingRunner struct {
+	runner
+	progress func() time.Time
+}
+
+func (r *readingRunner) Progress() time.Time {
+	return r.progress()
+}
+
+func TestChecker_progress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clock := mock.NewClock(time.Now())
+
+	sup := supervisor.New(supervisor.Params{
+		Logger: log.New(),
+	})
+
+	start := clock.Now()
+
+	// The processing is active because of the ticks, while the reader has
+	// stopped reading.
+	sup.Add(&readingRunner{
+		runner: runner{
+			readerID:  "journald",
+			heartbeat: clock.Now,
+		},
+		progress: func() time.Time {
+			return start
+		},
+	})
+
+	checker := health.New(health.Params{
+		Supervisor:  sup,
+		Clock:       clock,
+		ReadTimeout: 5 * time.Minute,
+	})
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- sup.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return checker.Check().Ready
+	}, time.Second, time.Millisecond)
+
+	clock.Add(4 * time.Minute)
+	assert.True(t, checker.Check().Live)
+
+	clock.Add(2 * time.Minute)
+
+	report := checker.Check()
+	assert.False(t, report.Live)
+	require.Len(t, report.Readers, 1)
+	assert.Contains(t, report.Readers[0].Reason, "no progress from reader for")
+
+	cancel()
+
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+}
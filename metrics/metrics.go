@@ -0,0 +1,309 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jeremija/taily/supervisor"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace is the prefix of all metric names.
+const namespace = "taily"
+
+// Metrics records taily's own metrics in a separate prometheus.Registry. All
+// methods can be called on a nil *Metrics, in which case nothing is
+// recorded, so that the metrics are optional.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	messagesRead    *prometheus.CounterVec
+	messagesDropped *prometheus.CounterVec
+	lag             *prometheus.GaugeVec
+	openGroups      *prometheus.GaugeVec
+	matches         *prometheus.CounterVec
+	actionsSent     *prometheus.CounterVec
+	actionsFailed   *prometheus.CounterVec
+	actionRetries   *prometheus.CounterVec
+	actionDuration  *prometheus.HistogramVec
+	stateSaves      *prometheus.CounterVec
+
+	mu         sync.Mutex
+	groupNames map[string]map[string]struct{} // groupNames are the processors in openGroups by reader.
+}
+
+// Params contains parameters for New.
+type Params struct {
+	// Supervisor, when set, is used to report the status and restarts of
+	// readers. Optional.
+	Supervisor *supervisor.Supervisor
+}
+
+// New creates a new instance of Metrics and registers all collectors,
+// including the process and Go runtime collectors.
+func New(params Params) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		messagesRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "messages_total",
+			Help:      "Number of messages read.",
+		}, []string{"reader_id"}),
+		messagesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "dropped_messages_total",
+			Help:      "Number of messages dropped due to overload.",
+		}, []string{"reader_id"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "reader",
+			Name:      "lag_seconds",
+			Help:      "Time between the timestamp of the last processed message and its processing.",
+		}, []string{"reader_id"}),
+		openGroups: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "processor",
+			Name:      "open_groups",
+			Help:      "Number of open groups, e.g. multiline matches, of the processor in the reader's pipeline.",
+		}, []string{"reader_id", "processor"}),
+		matches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "processor",
+			Name:      "matches_total",
+			Help:      "Number of matches for which the processor performed an action.",
+		}, []string{"processor"}),
+		actionsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "action",
+			Name:      "sent_total",
+			Help:      "Number of actions performed successfully.",
+		}, []string{"action"}),
+		actionsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "action",
+			Name:      "failed_total",
+			Help:      "Number of actions that failed.",
+		}, []string{"action"}),
+		actionRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "action",
+			Name:      "retries_total",
+			Help:      "Number of retries of failed actions.",
+		}, []string{"action"}),
+		actionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "action",
+			Name:      "duration_seconds",
+			Help:      "Time it took to perform an action.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"action"}),
+		stateSaves: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "state",
+			Name:      "saves_total",
+			Help:      "Number of reader state saves by result: success or failure.",
+		}, []string{"reader_id", "result"}),
+
+		groupNames: map[string]map[string]struct{}{},
+	}
+
+	m.registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+		m.messagesRead,
+		m.messagesDropped,
+		m.lag,
+		m.openGroups,
+		m.matches,
+		m.actionsSent,
+		m.actionsFailed,
+		m.actionRetries,
+		m.actionDuration,
+		m.stateSaves,
+	)
+
+	if params.Supervisor != nil {
+		m.registry.MustRegister(newSupervisorCollector(params.Supervisor))
+	}
+
+	return m
+}
+
+// Handler returns the HTTP handler that serves the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// MessageRead records a message read by the reader, processed at now.
+func (m *Metrics) MessageRead(readerID types.ReaderID, message types.Message, now time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.messagesRead.WithLabelValues(string(readerID)).Inc()
+	m.lag.WithLabelValues(string(readerID)).Set(now.Sub(message.Timestamp).Seconds())
+}
+
+// MessagesDropped records n messages dropped by the reader.
+func (m *Metrics) MessagesDropped(readerID types.ReaderID, n uint64) {
+	if m == nil {
+		return
+	}
+
+	m.messagesDropped.WithLabelValues(string(readerID)).Add(float64(n))
+}
+
+// OpenGroups records the number of open groups of the reader's processors by
+// processor name. The processors no longer in groups, e.g. after the
+// processors were swapped, are removed.
+func (m *Metrics) OpenGroups(readerID types.ReaderID, groups map[string]int) {
+	if m == nil {
+		return
+	}
+
+	id := string(readerID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.groupNames[id] {
+		if _, ok := groups[name]; !ok {
+			m.openGroups.DeleteLabelValues(id, name)
+		}
+	}
+
+	names := make(map[string]struct{}, len(groups))
+
+	for name, n := range groups {
+		m.openGroups.WithLabelValues(id, name).Set(float64(n))
+
+		names[name] = struct{}{}
+	}
+
+	m.groupNames[id] = names
+}
+
+// StateSaved records a save of the reader's state.
+func (m *Metrics) StateSaved(readerID types.ReaderID, err error) {
+	if m == nil {
+		return
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	m.stateSaves.WithLabelValues(string(readerID), result).Inc()
+}
+
+// RemoveReader removes the metrics of the reader, e.g. when the pipeline of
+// a docker container ends, so that the number of series does not grow with
+// every container ever started.
+func (m *Metrics) RemoveReader(readerID types.ReaderID) {
+	if m == nil {
+		return
+	}
+
+	id := string(readerID)
+
+	m.messagesRead.DeleteLabelValues(id)
+	m.messagesDropped.DeleteLabelValues(id)
+	m.lag.DeleteLabelValues(id)
+	m.stateSaves.DeleteLabelValues(id, "success")
+	m.stateSaves.DeleteLabelValues(id, "failure")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name := range m.groupNames[id] {
+		m.openGroups.DeleteLabelValues(id, name)
+	}
+
+	delete(m.groupNames, id)
+}
+
+// Matches wraps the action of the named processor, which might perform
+// several configured actions, so that every time it is performed is counted
+// as a single match. The action is returned unchanged when m is nil.
+func (m *Metrics) Matches(processorName string, a types.Action) types.Action {
+	if m == nil {
+		return a
+	}
+
+	return &matchesAction{
+		action:  a,
+		counter: m.matches.WithLabelValues(processorName),
+	}
+}
+
+// ActionRetried records a retry of the named action.
+func (m *Metrics) ActionRetried(name string) {
+	if m == nil {
+		return
+	}
+
+	m.actionRetries.WithLabelValues(name).Inc()
+}
+
+// Action wraps the named action so that its results and durations are
+// recorded. The action is returned unchanged when m is nil.
+func (m *Metrics) Action(name string, a types.Action) types.Action {
+	if m == nil {
+		return a
+	}
+
+	return &instrumentedAction{
+		action:   a,
+		sent:     m.actionsSent.WithLabelValues(name),
+		failed:   m.actionsFailed.WithLabelValues(name),
+		duration: m.actionDuration.WithLabelValues(name),
+	}
+}
+
+// matchesAction counts the matches of a processor.
+type matchesAction struct {
+	action  types.Action
+	counter prometheus.Counter
+}
+
+// PerformAction implements types.Action.
+func (a *matchesAction) PerformAction(ctx context.Context, messages []types.Message) error {
+	a.counter.Inc()
+
+	return errors.Trace(a.action.PerformAction(ctx, messages))
+}
+
+// instrumentedAction records the results and durations of an action.
+type instrumentedAction struct {
+	action   types.Action
+	sent     prometheus.Counter
+	failed   prometheus.Counter
+	duration prometheus.Observer
+}
+
+// PerformAction implements types.Action.
+func (a *instrumentedAction) PerformAction(ctx context.Context, messages []types.Message) error {
+	start := time.Now()
+
+	err := a.action.PerformAction(ctx, messages)
+
+	a.duration.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		a.failed.Inc()
+	} else {
+		a.sent.Inc()
+	}
+
+	return errors.Trace(err)
+}
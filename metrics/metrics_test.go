@@ -0,0 +1,111 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/action"
+	"github.com/jeremija/taily/metrics"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingAction struct{}
+
+func (failingAction) PerformAction(ctx context.Context, messages []types.Message) error {
+	return errors.New("test")
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New(metrics.Params{})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m.MessageRead("a", types.Message{Timestamp: now.Add(-2 * time.Second)}, now)
+	m.MessageRead("a", types.Message{Timestamp: now.Add(-time.Second)}, now)
+	m.MessagesDropped("a", 3)
+	m.OpenGroups("a", map[string]int{"errors": 4, "other": 1})
+	m.OpenGroups("a", map[string]int{"errors": 4})
+	m.StateSaved("a", nil)
+	m.StateSaved("a", errors.New("test"))
+	m.ActionRetried("fail")
+
+	ctx := context.Background()
+
+	// A match that performs several actions is counted once.
+	require.Error(t, m.Matches("errors", action.Multi{
+		{Action: m.Action("ok", mock.NewAction())},
+		{Action: m.Action("fail", failingAction{})},
+	}).PerformAction(ctx, nil))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	b, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+
+	body := string(b)
+
+	for _, want := range []string{
+		`taily_reader_messages_total{reader_id="a"} 2`,
+		`taily_reader_lag_seconds{reader_id="a"} 1`,
+		`taily_reader_dropped_messages_total{reader_id="a"} 3`,
+		`taily_processor_open_groups{processor="errors",reader_id="a"} 4`,
+		`taily_state_saves_total{reader_id="a",result="success"} 1`,
+		`taily_state_saves_total{reader_id="a",result="failure"} 1`,
+		`taily_processor_matches_total{processor="errors"} 1`,
+		`taily_action_sent_total{action="ok"} 1`,
+		`taily_action_failed_total{action="fail"} 1`,
+		`taily_action_retries_total{action="fail"} 1`,
+		`taily_action_duration_seconds_count{action="ok"} 1`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, want)
+	}
+
+	assert.NotContains(t, body, `processor="other"`, "removed processor should not be reported")
+}
+
+func TestMetrics_RemoveReader(t *testing.T) {
+	m := metrics.New(metrics.Params{})
+
+	now := time.Now()
+
+	for _, readerID := range []types.ReaderID{"a", "b"} {
+		m.MessageRead(readerID, types.Message{Timestamp: now}, now)
+		m.MessagesDropped(readerID, 1)
+		m.OpenGroups(readerID, map[string]int{"errors": 1})
+		m.StateSaved(readerID, nil)
+		m.StateSaved(readerID, errors.New("test"))
+	}
+
+	m.RemoveReader("a")
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+
+	assert.NotContains(t, body, `reader_id="a"`)
+	assert.Contains(t, body, `taily_reader_messages_total{reader_id="b"} 1`)
+}
+
+func TestMetrics_nil(t *testing.T) {
+	var m *metrics.Metrics
+
+	a := mock.NewAction()
+
+	assert.Same(t, a, m.Action("a", a))
+
+	m.MessageRead("a", types.Message{}, time.Now())
+	m.MessagesDropped("a", 1)
+	m.OpenGroups("a", map[string]int{"errors": 1})
+	m.StateSaved("a", nil)
+	m.ActionRetried("a")
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"github.com/jeremija/taily/supervisor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// supervisorCollector collects the status of readers from
+// supervisor.Supervisor on every scrape.
+type supervisorCollector struct {
+	supervisor *supervisor.Supervisor
+
+	up       *prometheus.Desc
+	restarts *prometheus.Desc
+}
+
+// newSupervisorCollector creates a new instance of supervisorCollector.
+func newSupervisorCollector(sup *supervisor.Supervisor) *supervisorCollector {
+	return &supervisorCollector{
+		supervisor: sup,
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "reader", "up"),
+			"Whether the reader is running.",
+			[]string{"reader_id"}, nil,
+		),
+		restarts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "reader", "restarts_total"),
+			"Number of restarts of the reader after a failure.",
+			[]string{"reader_id"}, nil,
+		),
+	}
+}
+
+// Assert that supervisorCollector implements prometheus.Collector.
+var _ prometheus.Collector = &supervisorCollector{}
+
+// Describe implements prometheus.Collector.
+func (c *supervisorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.restarts
+}
+
+// Collect implements prometheus.Collector.
+func (c *supervisorCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range c.supervisor.Status() {
+		var up float64
+
+		if status.State == supervisor.StateRunning {
+			up = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, string(status.ReaderID))
+		ch <- prometheus.MustNewConstMetric(c.restarts, prometheus.CounterValue, float64(status.Restarts), string(status.ReaderID))
+	}
+}
@@ -0,0 +1,62 @@
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jeremija/taily/types"
+)
+
+// Action is a types.Action that records all messages it was invoked with.
+type Action struct {
+	mu    sync.Mutex
+	calls [][]types.Message
+}
+
+// NewAction creates a new instance of Action.
+func NewAction() *Action {
+	return &Action{}
+}
+
+// Assert that Action implements types.Action.
+var _ types.Action = &Action{}
+
+// PerformAction implements types.Action.
+func (a *Action) PerformAction(ctx context.Context, messages []types.Message) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.calls = append(a.calls, messages)
+
+	return nil
+}
+
+// Calls returns messages from all recorded PerformAction calls.
+func (a *Action) Calls() [][]types.Message {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ret := make([][]types.Message, len(a.calls))
+	copy(ret, a.calls)
+
+	return ret
+}
+
+// Texts returns the texts of messages from all recorded PerformAction calls.
+func (a *Action) Texts() [][]string {
+	calls := a.Calls()
+
+	ret := make([][]string, len(calls))
+
+	for i, messages := range calls {
+		texts := make([]string, len(messages))
+
+		for j := range messages {
+			texts[j] = messages[j].Text()
+		}
+
+		ret[i] = texts
+	}
+
+	return ret
+}
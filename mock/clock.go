@@ -0,0 +1,110 @@
+package mock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jeremija/taily/types"
+)
+
+// Clock is a types.Clock whose time only changes when Add is called.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*Ticker
+}
+
+// Assert that Clock implements types.Clock.
+var _ types.Clock = &Clock{}
+
+// NewClock creates a new instance of Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{
+		now: now,
+	}
+}
+
+// Now implements types.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTicker implements types.Clock.
+func (c *Clock) NewTicker(d time.Duration) types.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &Ticker{
+		clock:    c,
+		interval: d,
+		next:     c.now.Add(d),
+		ch:       make(chan time.Time, 1),
+	}
+
+	c.tickers = append(c.tickers, t)
+
+	return t
+}
+
+// Add advances the clock by d and fires the tickers that are due. Like
+// time.Ticker, ticks are dropped when the receiver is not keeping up.
+func (c *Clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	for _, t := range c.tickers {
+		for !t.next.After(c.now) {
+			select {
+			case t.ch <- t.next:
+			default:
+			}
+
+			t.next = t.next.Add(t.interval)
+		}
+	}
+}
+
+// Ticker is a types.Ticker created by Clock.
+type Ticker struct {
+	clock    *Clock
+	interval time.Duration
+	next     time.Time
+	ch       chan time.Time
+}
+
+// C implements types.Ticker.
+func (t *Ticker) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop implements types.Ticker.
+func (t *Ticker) Stop() {
+	c := t.clock
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.tickers {
+		if other == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+
+			return
+		}
+	}
+}
+
+// Reset implements types.Ticker.
+func (t *Ticker) Reset(d time.Duration) {
+	c := t.clock
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t.interval = d
+	t.next = c.now.Add(d)
+}
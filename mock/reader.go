@@ -61,16 +61,23 @@ func (r *Reader) Accept(ctx context.Context) (*ReadCtx, error) {
 // newReadCtx creates a new instance of ReadCtx.
 func newReadCtx(params types.ReadLogsParams) *ReadCtx {
 	return &ReadCtx{
-		ch:   params.Ch,
-		done: make(chan struct{}),
+		params: params,
+		ch:     params.Ch,
+		done:   make(chan struct{}),
 	}
 }
 
 // ReadCtx is a mocked reading context that can be used for mocking messages.
 type ReadCtx struct {
-	ch   chan<- types.Message
-	done chan struct{}
-	once sync.Once
+	params types.ReadLogsParams
+	ch     chan<- types.Message
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Params returns the params ReadLogs was called with.
+func (r *ReadCtx) Params() types.ReadLogsParams {
+	return r.params
 }
 
 func (r *ReadCtx) Done() <-chan struct{} {
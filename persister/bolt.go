@@ -0,0 +1,320 @@
+package persister
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultBoltHistory is the default BoltParams.History.
+const DefaultBoltHistory = 10
+
+// Bucket names used by Bolt.
+var (
+	boltStatesBucket  = []byte("states")
+	boltUpdatedBucket = []byte("updated")
+	boltDataBucket    = []byte("data")
+)
+
+// Bolt is an implementation of Persister that keeps all state in a single
+// bbolt database file. Every SaveState is a separate transaction, and the
+// last History states are kept for each reader so that a reader can be
+// rolled back to a previous checkpoint.
+//
+// Close must be called to release the database file.
+type Bolt struct {
+	params BoltParams
+	db     *bolt.DB
+}
+
+// BoltParams contains parameters for NewBolt.
+type BoltParams struct {
+	Path    string // Path to the database file.
+	History int    // History is the number of states kept per reader. Defaults to DefaultBoltHistory.
+}
+
+// NewBolt opens or creates the database at params.Path. An error is returned
+// when the database is locked by another process for over a second.
+func NewBolt(params BoltParams) (*Bolt, error) {
+	if params.History <= 0 {
+		params.History = DefaultBoltHistory
+	}
+
+	db, err := bolt.Open(params.Path, 0600, &bolt.Options{
+		Timeout: time.Second,
+	})
+	if err != nil {
+		if types.IsError(err, bolt.ErrTimeout) {
+			return nil, errors.Errorf("database %q is locked by another process", params.Path)
+		}
+
+		return nil, errors.Annotatef(err, "open %q", params.Path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltStatesBucket, boltUpdatedBucket, boltDataBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+
+		return nil, errors.Trace(err)
+	}
+
+	return &Bolt{
+		params: params,
+		db:     db,
+	}, nil
+}
+
+// Assert that Bolt implements types.Persister and types.StateStore.
+var (
+	_ types.Persister  = &Bolt{}
+	_ types.StateStore = &Bolt{}
+)
+
+// Close closes the database.
+func (p *Bolt) Close() error {
+	return errors.Trace(p.db.Close())
+}
+
+// boltKey encodes a sequence number so that keys are sorted numerically.
+func boltKey(seq uint64) []byte {
+	key := make([]byte, 8)
+
+	binary.BigEndian.PutUint64(key, seq)
+
+	return key
+}
+
+// LoadState implements Persister. It returns the latest state.
+func (p *Bolt) LoadState(ctx context.Context, readerID types.ReaderID) (types.State, error) {
+	var state types.State
+
+	err := p.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltStatesBucket).Bucket([]byte(readerID))
+		if b == nil {
+			return nil
+		}
+
+		_, v := b.Cursor().Last()
+		if v == nil {
+			return nil
+		}
+
+		return errors.Trace(json.Unmarshal(v, &state))
+	})
+
+	return state, errors.Trace(err)
+}
+
+// SaveState implements Persister. It adds the state to the reader's history
+// and removes the states exceeding the History limit.
+func (p *Bolt) SaveState(ctx context.Context, readerID types.ReaderID, state types.State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	updated, err := time.Now().MarshalBinary()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = p.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltUpdatedBucket).Put([]byte(readerID), updated); err != nil {
+			return errors.Trace(err)
+		}
+
+		b, err := tx.Bucket(boltStatesBucket).CreateBucketIfNotExists([]byte(readerID))
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		if err := b.Put(boltKey(seq), data); err != nil {
+			return errors.Trace(err)
+		}
+
+		return errors.Trace(p.prune(b, seq))
+	})
+
+	return errors.Trace(err)
+}
+
+// prune removes the states older than the History limit, given the sequence
+// number of the latest state.
+func (p *Bolt) prune(b *bolt.Bucket, seq uint64) error {
+	c := b.Cursor()
+
+	for {
+		k, _ := c.First()
+		if k == nil || seq-binary.BigEndian.Uint64(k) < uint64(p.params.History) {
+			return nil
+		}
+
+		if err := c.Delete(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// ListStates implements types.StateStore.
+func (p *Bolt) ListStates(ctx context.Context) ([]types.StateInfo, error) {
+	var infos []types.StateInfo
+
+	err := p.db.View(func(tx *bolt.Tx) error {
+		updated := tx.Bucket(boltUpdatedBucket)
+
+		return tx.Bucket(boltStatesBucket).ForEach(func(k, _ []byte) error {
+			info := types.StateInfo{
+				ReaderID: types.ReaderID(k),
+			}
+
+			if v := updated.Get(k); v != nil {
+				if err := info.Updated.UnmarshalBinary(v); err != nil {
+					return errors.Annotatef(err, "updated %q", k)
+				}
+			}
+
+			infos = append(infos, info)
+
+			return nil
+		})
+	})
+
+	return infos, errors.Trace(err)
+}
+
+// DeleteState implements types.StateStore. It deletes the whole history of
+// the reader.
+func (p *Bolt) DeleteState(ctx context.Context, readerID types.ReaderID) error {
+	err := p.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(boltStatesBucket).DeleteBucket([]byte(readerID))
+		if err != nil && !types.IsError(err, bolt.ErrBucketNotFound) {
+			return errors.Trace(err)
+		}
+
+		return errors.Trace(tx.Bucket(boltUpdatedBucket).Delete([]byte(readerID)))
+	})
+
+	return errors.Trace(err)
+}
+
+// History returns the stored states of the reader, latest first.
+func (p *Bolt) History(ctx context.Context, readerID types.ReaderID) ([]types.State, error) {
+	var states []types.State
+
+	err := p.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltStatesBucket).Bucket([]byte(readerID))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var state types.State
+
+			if err := json.Unmarshal(v, &state); err != nil {
+				return errors.Annotatef(err, "state %d", binary.BigEndian.Uint64(k))
+			}
+
+			states = append(states, state)
+		}
+
+		return nil
+	})
+
+	return states, errors.Trace(err)
+}
+
+// Rollback removes the latest steps states of the reader so that the
+// previous checkpoint is loaded by LoadState. It returns the new latest
+// state, which is empty when no history remains, and the number of states
+// removed, which is less than steps when fewer states were kept.
+func (p *Bolt) Rollback(ctx context.Context, readerID types.ReaderID, steps int) (types.State, int, error) {
+	var removed int
+
+	err := p.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltStatesBucket).Bucket([]byte(readerID))
+		if b == nil {
+			return errors.NotFoundf("reader %q", readerID)
+		}
+
+		c := b.Cursor()
+
+		for i := 0; i < steps; i++ {
+			if k, _ := c.Last(); k == nil {
+				break
+			}
+
+			if err := c.Delete(); err != nil {
+				return errors.Trace(err)
+			}
+
+			removed++
+		}
+
+		// Reset the sequence so that the keys stay contiguous for prune.
+		var seq uint64
+
+		if k, _ := c.Last(); k != nil {
+			seq = binary.BigEndian.Uint64(k)
+		}
+
+		return errors.Trace(b.SetSequence(seq))
+	})
+	if err != nil {
+		return types.State{}, 0, errors.Trace(err)
+	}
+
+	state, err := p.LoadState(ctx, readerID)
+
+	return state, removed, errors.Trace(err)
+}
+
+// LoadData implements Persister.
+func (p *Bolt) LoadData(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+
+	err := p.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltDataBucket).Get([]byte(key)); len(v) > 0 {
+			// The value is only valid during the transaction.
+			data = append([]byte(nil), v...)
+		}
+
+		return nil
+	})
+
+	return data, errors.Trace(err)
+}
+
+// SaveData implements Persister. Empty data is deleted.
+func (p *Bolt) SaveData(ctx context.Context, key string, data []byte) error {
+	err := p.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltDataBucket)
+
+		if len(data) == 0 {
+			return errors.Trace(b.Delete([]byte(key)))
+		}
+
+		return errors.Trace(b.Put([]byte(key), data))
+	})
+
+	return errors.Trace(err)
+}
@@ -0,0 +1,126 @@
+package persister_test
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newState(sec int) types.State {
+	return types.State{
+		Timestamp:   time.Date(2022, 1, 1, 0, 0, sec, 0, time.UTC),
+		NumMessages: 1,
+	}
+}
+
+func TestBolt_History(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := persister.NewBolt(persister.BoltParams{
+		Path:    path.Join(t.TempDir(), "state.db"),
+		History: 3,
+	})
+	require.NoError(t, err)
+
+	defer p.Close()
+
+	state, err := p.LoadState(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, types.State{}, state)
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, p.SaveState(ctx, "test", newState(i)))
+	}
+
+	state, err = p.LoadState(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, newState(5), state)
+
+	history, err := p.History(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []types.State{newState(5), newState(4), newState(3)}, history)
+
+	state, removed, err := p.Rollback(ctx, "test", 1)
+	require.NoError(t, err)
+	assert.Equal(t, newState(4), state)
+	assert.Equal(t, 1, removed)
+
+	require.NoError(t, p.SaveState(ctx, "test", newState(6)))
+	require.NoError(t, p.SaveState(ctx, "test", newState(7)))
+
+	history, err = p.History(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []types.State{newState(7), newState(6), newState(4)}, history)
+
+	// Only the kept states can be removed.
+	state, removed, err = p.Rollback(ctx, "test", 5)
+	require.NoError(t, err)
+	assert.Equal(t, types.State{}, state)
+	assert.Equal(t, 3, removed)
+
+	_, _, err = p.Rollback(ctx, "other", 1)
+	assert.Error(t, err)
+}
+
+func TestBolt_Data(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := persister.NewBolt(persister.BoltParams{
+		Path: path.Join(t.TempDir(), "state.db"),
+	})
+	require.NoError(t, err)
+
+	defer p.Close()
+
+	data, err := p.LoadData(ctx, "key")
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+	require.NoError(t, p.SaveData(ctx, "key", []byte("value")))
+
+	data, err = p.LoadData(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), data)
+
+	require.NoError(t, p.SaveData(ctx, "key", nil))
+
+	data, err = p.LoadData(ctx, "key")
+	require.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func TestMigrateFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	src := persister.NewFile(dir)
+
+	require.NoError(t, src.SaveState(ctx, "a", newState(1)))
+	require.NoError(t, src.SaveState(ctx, "docker:123", newState(2)))
+	require.NoError(t, src.SaveData(ctx, "processors_a", []byte("[]")))
+
+	dst, err := persister.NewBolt(persister.BoltParams{
+		Path: path.Join(dir, "state.db"),
+	})
+	require.NoError(t, err)
+
+	defer dst.Close()
+
+	stats, err := persister.MigrateFile(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, persister.MigrateStats{States: 2, Data: 1}, stats)
+
+	state, err := dst.LoadState(ctx, "docker:123")
+	require.NoError(t, err)
+	assert.Equal(t, newState(2), state)
+
+	data, err := dst.LoadData(ctx, "processors_a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("[]"), data)
+}
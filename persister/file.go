@@ -4,20 +4,28 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"io"
 	"math/rand"
 	"os"
 	"path"
+	"strings"
+	"syscall"
 
 	"github.com/jeremija/taily/types"
 	"github.com/juju/errors"
 )
 
 // File is an implementation of Persister that keeps track of all
-// state on local disk.
+// state on local disk. Writes are atomic and synced to disk before they are
+// considered complete.
 type File struct {
-	dir string
+	dir  string
+	lock *os.File // lock is the locked lock file, if any.
 }
 
+// fileLockName is the name of the lock file in the state directory.
+const fileLockName = ".lock"
+
 // NewFile creates a new instance of File. The dir parameter
 // must be writable by the current process.
 func NewFile(dir string) *File {
@@ -29,6 +37,48 @@ func NewFile(dir string) *File {
 // Assert that File implements types.Persister.
 var _ types.Persister = File{}
 
+// Lock acquires an exclusive advisory lock on the state directory so that
+// another instance using the same directory fails fast instead of
+// overwriting the state. It does not wait for the lock to be released. The
+// lock is held until Close is called or the process exits.
+func (p *File) Lock() error {
+	if err := os.MkdirAll(p.dir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+
+	f, err := os.OpenFile(path.Join(p.dir, fileLockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+
+		if types.IsError(err, syscall.EWOULDBLOCK) {
+			return errors.Errorf("state directory %q is locked by another process", p.dir)
+		}
+
+		return errors.Annotatef(err, "lock %q", p.dir)
+	}
+
+	p.lock = f
+
+	return nil
+}
+
+// Close releases the lock acquired by Lock, if any.
+func (p *File) Close() error {
+	if p.lock == nil {
+		return nil
+	}
+
+	// Closing the file releases the lock.
+	err := p.lock.Close()
+	p.lock = nil
+
+	return errors.Trace(err)
+}
+
 // filename returns a filename for readerID.
 func (p File) filename(readerID types.ReaderID) string {
 	return path.Join(p.dir, string(readerID)+".json")
@@ -58,7 +108,140 @@ func (p File) LoadState(ctx context.Context, readerID types.ReaderID) (types.Sta
 
 // SaveState implements Persister.
 func (p File) SaveState(ctx context.Context, readerID types.ReaderID, state types.State) error {
-	if err := os.MkdirAll(p.dir, 0755); err != nil {
+	err := p.writeFile(p.filename(readerID), func(w io.Writer) error {
+		return errors.Trace(json.NewEncoder(w).Encode(state))
+	})
+
+	return errors.Trace(err)
+}
+
+// Assert that File implements types.StateStore.
+var _ types.StateStore = File{}
+
+// ListStates implements types.StateStore. The modification time of the file
+// is used as the update time.
+func (p File) ListStates(ctx context.Context) ([]types.StateInfo, error) {
+	entries, err := p.list(p.dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var infos []types.StateInfo
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		infos = append(infos, types.StateInfo{
+			ReaderID: types.ReaderID(strings.TrimSuffix(entry.Name(), ".json")),
+			Updated:  fi.ModTime(),
+		})
+	}
+
+	return infos, nil
+}
+
+// DeleteState implements types.StateStore.
+func (p File) DeleteState(ctx context.Context, readerID types.ReaderID) error {
+	err := os.Remove(p.filename(readerID))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// DataKeys returns the keys of all stored data.
+func (p File) DataKeys(ctx context.Context) ([]string, error) {
+	entries, err := p.list(path.Join(p.dir, "data"))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var keys []string
+
+	for _, entry := range entries {
+		// Skip leftovers of interrupted writes.
+		if !strings.Contains(entry.Name(), ".tmp") {
+			keys = append(keys, entry.Name())
+		}
+	}
+
+	return keys, nil
+}
+
+// list returns the regular files in dir. A missing dir is treated as empty.
+func (p File) list(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errors.Trace(err)
+	}
+
+	ret := make([]os.DirEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			ret = append(ret, entry)
+		}
+	}
+
+	return ret, nil
+}
+
+// dataFilename returns a filename for data stored under key.
+func (p File) dataFilename(key string) string {
+	return path.Join(p.dir, "data", key)
+}
+
+// LoadData implements Persister.
+func (p File) LoadData(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(p.dataFilename(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errors.Trace(err)
+	}
+
+	return data, nil
+}
+
+// SaveData implements Persister. Empty data is deleted.
+func (p File) SaveData(ctx context.Context, key string, data []byte) error {
+	if len(data) == 0 {
+		err := os.Remove(p.dataFilename(key))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+
+		return nil
+	}
+
+	err := p.writeFile(p.dataFilename(key), func(w io.Writer) error {
+		_, err := w.Write(data)
+
+		return errors.Trace(err)
+	})
+
+	return errors.Trace(err)
+}
+
+// writeFile creates the file's directory and atomically replaces the file with
+// the contents written by write. Both the file and the directory are synced
+// so that the new contents survive a crash or power loss.
+func (p File) writeFile(filename string, write func(io.Writer) error) (err error) {
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
 		return errors.Trace(err)
 	}
 
@@ -71,17 +254,29 @@ func (p File) SaveState(ctx context.Context, readerID types.ReaderID, state type
 	// We store to a tmp filename first so we don't lose the old state in case we
 	// fail to write it. After a successful write, we rename the tmp file to a
 	// new one.
-	filename := p.filename(readerID)
-	tmpFilename := p.filename(readerID) + ".tmp" + hex.EncodeToString(tmp)
+	tmpFilename := filename + ".tmp" + hex.EncodeToString(tmp)
 
 	f, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	defer f.Close()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpFilename)
+		}
+	}()
 
-	if err := json.NewEncoder(f).Encode(state); err != nil {
+	if err := write(f); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := f.Close(); err != nil {
 		return errors.Trace(err)
 	}
 
@@ -89,5 +284,17 @@ func (p File) SaveState(ctx context.Context, readerID types.ReaderID, state type
 		return errors.Trace(err)
 	}
 
-	return nil
+	return errors.Trace(syncDir(path.Dir(filename)))
+}
+
+// syncDir syncs the directory so that renames within it are persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	defer d.Close()
+
+	return errors.Trace(d.Sync())
 }
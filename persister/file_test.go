@@ -0,0 +1,46 @@
+package persister_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jeremija/taily/persister"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile_Lock(t *testing.T) {
+	dir := t.TempDir()
+
+	p1 := persister.NewFile(dir)
+	require.NoError(t, p1.Lock())
+
+	p2 := persister.NewFile(dir)
+	err := p2.Lock()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is locked by another process")
+
+	require.NoError(t, p1.Close())
+	require.NoError(t, p2.Lock())
+	require.NoError(t, p2.Close())
+}
+
+func TestFile_SaveState(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p := persister.NewFile(dir)
+
+	require.NoError(t, p.SaveState(ctx, "test", newState(1)))
+	require.NoError(t, p.SaveState(ctx, "test", newState(2)))
+
+	state, err := p.LoadState(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, newState(2), state)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "tmp files should not be left behind")
+	assert.Equal(t, "test.json", entries[0].Name())
+}
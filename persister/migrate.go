@@ -0,0 +1,61 @@
+package persister
+
+import (
+	"context"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// MigrateStats contains the number of entries migrated by MigrateFile.
+type MigrateStats struct {
+	States int // States is the number of reader states copied.
+	Data   int // Data is the number of data entries copied.
+}
+
+// MigrateFile copies all reader states and data stored by src to dst, for
+// example when switching from File to Bolt. Existing entries in dst are
+// overwritten.
+func MigrateFile(ctx context.Context, src *File, dst types.Persister) (MigrateStats, error) {
+	var stats MigrateStats
+
+	infos, err := src.ListStates(ctx)
+	if err != nil {
+		return stats, errors.Trace(err)
+	}
+
+	for _, info := range infos {
+		readerID := info.ReaderID
+
+		state, err := src.LoadState(ctx, readerID)
+		if err != nil {
+			return stats, errors.Annotatef(err, "load state %q", readerID)
+		}
+
+		if err := dst.SaveState(ctx, readerID, state); err != nil {
+			return stats, errors.Annotatef(err, "save state %q", readerID)
+		}
+
+		stats.States++
+	}
+
+	keys, err := src.DataKeys(ctx)
+	if err != nil {
+		return stats, errors.Trace(err)
+	}
+
+	for _, key := range keys {
+		data, err := src.LoadData(ctx, key)
+		if err != nil {
+			return stats, errors.Annotatef(err, "load data %q", key)
+		}
+
+		if err := dst.SaveData(ctx, key, data); err != nil {
+			return stats, errors.Annotatef(err, "save data %q", key)
+		}
+
+		stats.Data++
+	}
+
+	return stats, nil
+}
@@ -10,8 +10,11 @@ import (
 // can be used for testing so that the daemon always reads something.
 type Noop struct{}
 
-// Assert that Noop implements types.Persister.
-var _ types.Persister = Noop{}
+// Assert that Noop implements types.Persister and types.StateStore.
+var (
+	_ types.Persister  = Noop{}
+	_ types.StateStore = Noop{}
+)
 
 // NewNoop creates a new intance of Noop.
 func NewNoop() Noop {
@@ -27,3 +30,23 @@ func (n Noop) LoadState(ctx context.Context, readerID types.ReaderID) (types.Sta
 func (n Noop) SaveState(ctx context.Context, readerID types.ReaderID, state types.State) error {
 	return nil
 }
+
+// LoadData implements Persister.
+func (n Noop) LoadData(ctx context.Context, key string) ([]byte, error) {
+	return nil, nil
+}
+
+// SaveData implements Persister.
+func (n Noop) SaveData(ctx context.Context, key string, data []byte) error {
+	return nil
+}
+
+// ListStates implements types.StateStore.
+func (n Noop) ListStates(ctx context.Context) ([]types.StateInfo, error) {
+	return nil, nil
+}
+
+// DeleteState implements types.StateStore.
+func (n Noop) DeleteState(ctx context.Context, readerID types.ReaderID) error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package persister
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// DefaultRetentionInterval is the default Retention.Interval.
+const DefaultRetentionInterval = time.Hour
+
+// Retention configures pruning of stale reader states.
+type Retention struct {
+	Interval time.Duration // Interval between prunes. Defaults to DefaultRetentionInterval.
+	// MaxAge is the age after which states that have not been updated are
+	// deleted. Disabled when zero.
+	MaxAge time.Duration
+}
+
+// PruneParams contains parameters for Prune.
+type PruneParams struct {
+	Store  types.StateStore // Store to prune.
+	Prefix string           // Prefix of the reader IDs to consider.
+	MaxAge time.Duration    // MaxAge of states. Disabled when zero.
+	Now    time.Time        // Now is the time to compare state age with.
+	// Active returns true for states in use, which are never deleted.
+	Active func(types.ReaderID) bool
+	// Exists returns false for states whose source no longer exists, which
+	// are deleted regardless of their age.
+	Exists func(types.ReaderID) bool
+}
+
+// Prune deletes states with params.Prefix that are not active and either no
+// longer exist or are older than params.MaxAge. It returns the reader IDs of
+// deleted states.
+func Prune(ctx context.Context, params PruneParams) ([]types.ReaderID, error) {
+	infos, err := params.Store.ListStates(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var deleted []types.ReaderID
+
+	for _, info := range infos {
+		readerID := info.ReaderID
+
+		if !strings.HasPrefix(string(readerID), params.Prefix) || params.Active(readerID) {
+			continue
+		}
+
+		stale := params.MaxAge > 0 && params.Now.Sub(info.Updated) > params.MaxAge
+
+		if params.Exists(readerID) && !stale {
+			continue
+		}
+
+		if err := params.Store.DeleteState(ctx, readerID); err != nil {
+			return deleted, errors.Annotatef(err, "delete %q", readerID)
+		}
+
+		deleted = append(deleted, readerID)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,91 @@
+package persister_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	p := persister.NewFile(dir)
+
+	for _, readerID := range []types.ReaderID{
+		"docker", "docker:active", "docker:removed", "docker:stale", "docker:fresh",
+	} {
+		require.NoError(t, p.SaveState(ctx, readerID, newState(1)))
+	}
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	require.NoError(t, os.Chtimes(path.Join(dir, "docker:active.json"), old, old))
+	require.NoError(t, os.Chtimes(path.Join(dir, "docker:stale.json"), old, old))
+
+	deleted, err := persister.Prune(ctx, persister.PruneParams{
+		Store:  p,
+		Prefix: "docker:",
+		MaxAge: time.Hour,
+		Now:    now,
+		Active: func(readerID types.ReaderID) bool {
+			return readerID == "docker:active"
+		},
+		Exists: func(readerID types.ReaderID) bool {
+			return readerID != "docker:removed"
+		},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []types.ReaderID{"docker:removed", "docker:stale"}, deleted)
+
+	infos, err := p.ListStates(ctx)
+	require.NoError(t, err)
+
+	var readerIDs []types.ReaderID
+
+	for _, info := range infos {
+		readerIDs = append(readerIDs, info.ReaderID)
+	}
+
+	assert.ElementsMatch(t, []types.ReaderID{"docker", "docker:active", "docker:fresh"}, readerIDs)
+}
+
+func TestBolt_DeleteState(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := persister.NewBolt(persister.BoltParams{
+		Path: path.Join(t.TempDir(), "state.db"),
+	})
+	require.NoError(t, err)
+
+	defer p.Close()
+
+	require.NoError(t, p.SaveState(ctx, "a", newState(1)))
+	require.NoError(t, p.SaveState(ctx, "b", newState(2)))
+
+	infos, err := p.ListStates(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, types.ReaderID("a"), infos[0].ReaderID)
+	assert.WithinDuration(t, time.Now(), infos[0].Updated, time.Minute)
+
+	require.NoError(t, p.DeleteState(ctx, "a"))
+	require.NoError(t, p.DeleteState(ctx, "missing"))
+
+	infos, err = p.ListStates(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, types.ReaderID("b"), infos[0].ReaderID)
+
+	state, err := p.LoadState(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, types.State{}, state)
+}
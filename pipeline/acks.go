@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/jeremija/taily/types"
+)
+
+// acks tracks the messages read until they are completely processed, so that
+// they are acknowledged to the Watcher in the order they were read only once
+// the processors are done with them, see types.Hold.
+type acks struct {
+	mu      sync.Mutex
+	entries []*ackEntry
+	readyCh chan struct{} // readyCh is signaled when a held message is released.
+}
+
+// ackEntry is a single message tracked by acks.
+type ackEntry struct {
+	acks      *acks
+	processed bool // processed is true once ProcessMessage has returned.
+	holds     int  // holds is the number of holds not yet released.
+}
+
+// newAcks creates a new instance of acks.
+func newAcks() *acks {
+	return &acks{
+		readyCh: make(chan struct{}, 1),
+	}
+}
+
+// add starts tracking the next message.
+func (a *acks) add() *ackEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e := &ackEntry{acks: a}
+
+	a.entries = append(a.entries, e)
+
+	return e
+}
+
+// addProcessed tracks n messages which need no processing, e.g. because they
+// were dropped.
+func (a *acks) addProcessed(n int) {
+	for i := 0; i < n; i++ {
+		a.add().done()
+	}
+}
+
+// Assert that ackEntry implements types.Holder.
+var _ types.Holder = &ackEntry{}
+
+// Hold implements types.Holder.
+func (e *ackEntry) Hold() func() {
+	e.acks.mu.Lock()
+	e.holds++
+	e.acks.mu.Unlock()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(e.release)
+	}
+}
+
+// release releases a single hold.
+func (e *ackEntry) release() {
+	e.acks.mu.Lock()
+
+	if e.holds > 0 {
+		e.holds--
+	}
+
+	e.acks.mu.Unlock()
+
+	select {
+	case e.acks.readyCh <- struct{}{}:
+	default:
+	}
+}
+
+// done marks the message as processed once ProcessMessage has returned. The
+// messages interrupted by the shutdown are never done, so they are read
+// again.
+func (e *ackEntry) done() {
+	e.acks.mu.Lock()
+	e.processed = true
+	e.acks.mu.Unlock()
+}
+
+// ready removes the completely processed messages preceding the first
+// incomplete one and returns their number.
+func (a *acks) ready() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var n int
+
+	for n < len(a.entries) && a.entries[n].processed && a.entries[n].holds == 0 {
+		n++
+	}
+
+	a.entries = a.entries[n:]
+
+	return n
+}
+
+// releaseAll releases all holds. It is used when the held messages have been
+// handed over to a snapshot of the processor state, so they no longer need to
+// be read again.
+func (a *acks) releaseAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range a.entries {
+		e.holds = 0
+	}
+}
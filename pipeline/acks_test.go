@@ -0,0 +1,157 @@
+package pipeline_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// ackWatcher is a pipeline.AsyncWatcher that sends the messages and counts
+// the acknowledgements.
+type ackWatcher struct {
+	messages []types.Message
+	acked    int64
+}
+
+func (w *ackWatcher) WatchAsync(ctx context.Context, ch chan<- types.Message) <-chan error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+
+		for _, message := range w.messages {
+			ch <- message
+		}
+
+		<-ctx.Done()
+
+		errCh <- ctx.Err()
+	}()
+
+	return errCh
+}
+
+func (w *ackWatcher) Ack() {
+	atomic.AddInt64(&w.acked, 1)
+}
+
+func (w *ackWatcher) Persist() {}
+
+func (w *ackWatcher) numAcked() int {
+	return int(atomic.LoadInt64(&w.acked))
+}
+
+// blocked is a processor that does not finish processing a message until
+// the gate is closed.
+type blocked struct {
+	gate chan struct{}
+}
+
+func (b blocked) ProcessMessage(ctx context.Context, message types.Message) error {
+	<-b.gate
+
+	return nil
+}
+
+func (b blocked) Tick(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+func TestPipeline_Hold(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	messages := []types.Message{
+		types.NewMessage(ts, "test", "hello", nil),
+		types.NewMessage(ts, "test", "panic: boom", nil),
+		types.NewMessage(ts, "test", "\tmain.go:1", nil),
+	}
+
+	// run processes the messages and checks that only the first numDone are
+	// acknowledged before release is called.
+	run := func(t *testing.T, clock *mock.Clock, newProcessor func() (types.Processor, error), numDone int, release func()) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		w := &ackWatcher{messages: messages}
+
+		pline := pipeline.New(pipeline.Params{
+			Logger:       log.New(),
+			Watcher:      w,
+			NewProcessor: newProcessor,
+			Time: pipeline.Time{
+				Clock:        clock,
+				TickInterval: time.Second,
+			},
+		})
+
+		errCh := make(chan error, 1)
+
+		go func() {
+			errCh <- pline.ProcessPipeline(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return w.numAcked() == numDone
+		}, time.Second, 5*time.Millisecond)
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, numDone, w.numAcked(), "acknowledged held messages")
+
+		release()
+
+		assert.Eventually(t, func() bool {
+			return w.numAcked() == len(messages)
+		}, time.Second, 5*time.Millisecond)
+
+		cancel()
+
+		err := <-errCh
+		assert.True(t, types.IsError(err, context.Canceled), "expected context.Canceled, but got: %+v", err)
+	}
+
+	t.Run("open group", func(t *testing.T) {
+		action := mock.NewAction()
+		clock := mock.NewClock(ts)
+
+		// The group is flushed on the next tick.
+		run(t, clock, func() (types.Processor, error) {
+			return processor.NewMatcher(processor.MatcherParams{
+				StartLine: matcher.Prefix("panic:"),
+				EndLine:   matcher.Not(matcher.Prefix("\t")),
+				Action:    action,
+			}), nil
+		}, 1, func() {
+			clock.Add(time.Second)
+		})
+
+		assert.Equal(t, [][]string{
+			{"panic: boom", "\tmain.go:1"},
+		}, action.Texts())
+	})
+
+	t.Run("parallel queue", func(t *testing.T) {
+		gate := make(chan struct{})
+
+		// The messages are queued for a blocked processor.
+		run(t, mock.NewClock(ts), func() (types.Processor, error) {
+			return processor.NewParallel(processor.ParallelParams{
+				Logger: log.New(),
+				Processors: []types.Processor{
+					processor.NewAny(mock.NewAction()),
+					blocked{gate: gate},
+				},
+			}), nil
+		}, 0, func() {
+			close(gate)
+		})
+	})
+}
@@ -0,0 +1,341 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// Overload describes what happens to new messages when the buffer is full.
+type Overload string
+
+// Values for Overload.
+const (
+	// OverloadBlock stops reading until there is room in the buffer. This is
+	// the default.
+	OverloadBlock Overload = "block"
+	// OverloadDrop drops new messages and counts them. Dropped messages are
+	// acknowledged and will not be read again.
+	OverloadDrop Overload = "drop"
+	// OverloadSpill writes new messages to a file on disk and reads them back
+	// once there is room in the buffer.
+	OverloadSpill Overload = "spill"
+)
+
+// Buffer contains the buffering configuration of a Pipeline.
+type Buffer struct {
+	Size     int      // Size is the number of messages buffered in memory. At least one.
+	Overload Overload // Overload is the policy when the buffer is full. Defaults to OverloadBlock.
+	SpillDir string   // SpillDir is the directory for OverloadSpill files. Defaults to os.TempDir().
+}
+
+// Validate returns an error when the Overload is not known.
+func (b Buffer) Validate() error {
+	switch b.Overload {
+	case "", OverloadBlock, OverloadDrop, OverloadSpill:
+		return nil
+	default:
+		return errors.Errorf("unknown overload policy: %q", b.Overload)
+	}
+}
+
+// bufferEntry is either a message or a number of dropped messages.
+type bufferEntry struct {
+	message *types.Message
+	dropped int
+}
+
+// buffer moves messages from the watcher to the processing loop according to
+// the Buffer configuration. It preserves the order of messages, including the
+// dropped ones, so that they are acknowledged in the order they were read.
+type buffer struct {
+	params  Buffer
+	logger  log.Logger
+	dropped *uint64 // dropped is the total number of dropped messages.
+
+	entries     []bufferEntry
+	numMessages int // numMessages is the number of messages in entries.
+	spill       *spillFile
+	// spillDropped is the number of messages dropped after the spilled ones,
+	// to be added to entries once the spill file is drained.
+	spillDropped int
+}
+
+// newBuffer creates a new buffer.
+func newBuffer(params Buffer, logger log.Logger, dropped *uint64) *buffer {
+	if params.Size < 1 {
+		params.Size = 1
+	}
+
+	if params.Overload == "" {
+		params.Overload = OverloadBlock
+	}
+
+	return &buffer{
+		params:  params,
+		logger:  logger,
+		dropped: dropped,
+	}
+}
+
+// full returns true when no more messages can be kept in memory.
+func (b *buffer) full() bool {
+	return b.numMessages >= b.params.Size
+}
+
+// push adds the message to the buffer, or handles it according to the
+// overload policy when the buffer is full.
+func (b *buffer) push(message types.Message) {
+	spilling := b.spill != nil && b.spill.len() > 0
+
+	if !b.full() && !spilling {
+		b.entries = append(b.entries, bufferEntry{message: &message})
+		b.numMessages++
+
+		return
+	}
+
+	if b.params.Overload == OverloadSpill {
+		err := b.writeSpill(message)
+		if err == nil {
+			return
+		}
+
+		b.logger.Error("Failed to spill message, dropping", err, nil)
+
+		if spilling {
+			// Keep the order: the message comes after the spilled ones.
+			atomic.AddUint64(b.dropped, 1)
+			b.spillDropped++
+
+			return
+		}
+	}
+
+	atomic.AddUint64(b.dropped, 1)
+	b.drop(1)
+}
+
+// drop records n dropped messages after the last entry.
+func (b *buffer) drop(n int) {
+	if last := len(b.entries) - 1; last >= 0 && b.entries[last].message == nil {
+		b.entries[last].dropped += n
+
+		return
+	}
+
+	b.entries = append(b.entries, bufferEntry{dropped: n})
+}
+
+// writeSpill writes the message to the spill file, creating it if necessary.
+func (b *buffer) writeSpill(message types.Message) error {
+	if b.spill == nil {
+		spill, err := newSpillFile(b.params.SpillDir)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		b.spill = spill
+	}
+
+	return errors.Trace(b.spill.write(message))
+}
+
+// refill moves spilled messages to memory while there is room.
+func (b *buffer) refill() {
+	for b.spill != nil && b.spill.len() > 0 && !b.full() {
+		remaining := b.spill.len()
+
+		message, err := b.spill.read()
+		if err != nil {
+			// Do not get stuck on a corrupt file. The remaining messages were
+			// not processed, so they are counted as dropped.
+			b.logger.Error("Failed to read spilled messages, dropping", err, nil)
+
+			atomic.AddUint64(b.dropped, uint64(remaining))
+			b.drop(remaining)
+
+			b.spill.close()
+			b.spill = nil
+
+			break
+		}
+
+		b.entries = append(b.entries, bufferEntry{message: &message})
+		b.numMessages++
+	}
+
+	if b.spillDropped > 0 && (b.spill == nil || b.spill.len() == 0) {
+		b.drop(b.spillDropped)
+		b.spillDropped = 0
+	}
+}
+
+// pop removes the first entry.
+func (b *buffer) pop() {
+	if b.entries[0].message != nil {
+		b.numMessages--
+	}
+
+	b.entries[0] = bufferEntry{}
+	b.entries = b.entries[1:]
+
+	b.refill()
+}
+
+// run moves messages from in to out until in is closed and all entries have
+// been sent. It closes out when done.
+func (b *buffer) run(in <-chan types.Message, out chan<- bufferEntry) {
+	defer close(out)
+
+	defer func() {
+		if b.spill != nil {
+			b.spill.close()
+		}
+	}()
+
+	for {
+		if in == nil && len(b.entries) == 0 {
+			return
+		}
+
+		recvCh := in
+		if b.params.Overload == OverloadBlock && b.full() {
+			recvCh = nil
+		}
+
+		var (
+			sendCh chan<- bufferEntry
+			entry  bufferEntry
+		)
+
+		if len(b.entries) > 0 {
+			sendCh = out
+			entry = b.entries[0]
+		}
+
+		select {
+		case message, ok := <-recvCh:
+			if !ok {
+				in = nil
+
+				continue
+			}
+
+			b.push(message)
+		case sendCh <- entry:
+			b.pop()
+		}
+	}
+}
+
+// spillFile is a FIFO queue of messages in a temporary file. It does not
+// need to survive restarts because spilled messages are not acknowledged
+// and are read again by the reader.
+type spillFile struct {
+	f      *os.File
+	w      *bufio.Writer
+	offset int64 // offset of the next message to read.
+	count  int   // count of messages in the file.
+}
+
+// newSpillFile creates a new spill file in dir.
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "taily-spill-*")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &spillFile{
+		f: f,
+		w: bufio.NewWriter(f),
+	}, nil
+}
+
+// len returns the number of messages in the file.
+func (s *spillFile) len() int {
+	return s.count
+}
+
+// write appends the length-prefixed message to the file.
+func (s *spillFile) write(message types.Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var size [4]byte
+
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+
+	if _, err := s.w.Write(size[:]); err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err := s.w.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+
+	s.count++
+
+	return nil
+}
+
+// read reads the oldest message from the file.
+func (s *spillFile) read() (types.Message, error) {
+	var message types.Message
+
+	if err := s.w.Flush(); err != nil {
+		return message, errors.Trace(err)
+	}
+
+	var size [4]byte
+
+	if _, err := s.f.ReadAt(size[:], s.offset); err != nil {
+		return message, errors.Trace(err)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+
+	if _, err := s.f.ReadAt(data, s.offset+int64(len(size))); err != nil {
+		return message, errors.Trace(err)
+	}
+
+	s.offset += int64(len(size) + len(data))
+	s.count--
+
+	if s.count == 0 {
+		// Failing to truncate only wastes disk space until close.
+		_ = s.truncate()
+	}
+
+	return message, errors.Trace(json.Unmarshal(data, &message))
+}
+
+// truncate empties the file once all messages have been read.
+func (s *spillFile) truncate() error {
+	if err := s.f.Truncate(0); err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+
+	s.offset = 0
+
+	return nil
+}
+
+// close closes and removes the file.
+func (s *spillFile) close() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMessages(n int) []types.Message {
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ret := make([]types.Message, n)
+
+	for i := range ret {
+		ret[i] = types.NewMessage(ts, "test", strconv.Itoa(i+1), nil)
+	}
+
+	return ret
+}
+
+// drain pops all entries and returns the message texts, with dropped
+// messages as "-".
+func drain(b *buffer) []string {
+	var ret []string
+
+	for len(b.entries) > 0 {
+		entry := b.entries[0]
+
+		if entry.message != nil {
+			ret = append(ret, entry.message.Text())
+		}
+
+		for i := 0; i < entry.dropped; i++ {
+			ret = append(ret, "-")
+		}
+
+		b.pop()
+	}
+
+	return ret
+}
+
+func TestBuffer_Drop(t *testing.T) {
+	var dropped uint64
+
+	b := newBuffer(Buffer{Size: 2, Overload: OverloadDrop}, log.New(), &dropped)
+
+	for _, message := range newTestMessages(5) {
+		b.push(message)
+	}
+
+	assert.Equal(t, uint64(3), dropped)
+	assert.Len(t, b.entries, 3)
+	assert.Equal(t, []string{"1", "2", "-", "-", "-"}, drain(b))
+}
+
+func TestBuffer_Spill(t *testing.T) {
+	var dropped uint64
+
+	b := newBuffer(Buffer{Size: 2, Overload: OverloadSpill, SpillDir: t.TempDir()}, log.New(), &dropped)
+
+	defer func() {
+		b.spill.close()
+	}()
+
+	messages := newTestMessages(6)
+
+	for _, message := range messages[:5] {
+		b.push(message)
+	}
+
+	assert.Len(t, b.entries, 2)
+	assert.Equal(t, 3, b.spill.len())
+
+	b.pop()
+	b.push(messages[5])
+
+	assert.Equal(t, []string{"2", "3", "4", "5", "6"}, drain(b))
+	assert.Equal(t, uint64(0), dropped)
+	assert.Equal(t, 0, b.spill.len())
+
+	// The spill file is reused after it is drained.
+	for _, message := range messages[:4] {
+		b.push(message)
+	}
+
+	assert.Equal(t, []string{"1", "2", "3", "4"}, drain(b))
+}
+
+func TestBuffer_Run(t *testing.T) {
+	for _, overload := range []Overload{OverloadBlock, OverloadDrop, OverloadSpill} {
+		overload := overload
+
+		t.Run(string(overload), func(t *testing.T) {
+			var dropped uint64
+
+			b := newBuffer(Buffer{Size: 3, Overload: overload, SpillDir: t.TempDir()}, log.New(), &dropped)
+
+			in := make(chan types.Message)
+			out := make(chan bufferEntry)
+
+			go b.run(in, out)
+
+			go func() {
+				defer close(in)
+
+				for _, message := range newTestMessages(100) {
+					in <- message
+				}
+			}()
+
+			var (
+				texts      []string
+				numDropped int
+			)
+
+			for entry := range out {
+				if entry.message != nil {
+					texts = append(texts, entry.message.Text())
+				}
+
+				numDropped += entry.dropped
+			}
+
+			require.Equal(t, 100, len(texts)+numDropped)
+			assert.Equal(t, uint64(numDropped), dropped)
+
+			for i := 1; i < len(texts); i++ {
+				prev, _ := strconv.Atoi(texts[i-1])
+				cur, _ := strconv.Atoi(texts[i])
+				assert.Less(t, prev, cur, "messages out of order")
+			}
+
+			if overload != OverloadDrop {
+				assert.Equal(t, 0, numDropped)
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@ package pipeline
 
 import (
 	"context"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jeremija/taily/metrics"
 	"github.com/jeremija/taily/processor"
 	"github.com/jeremija/taily/types"
 	"github.com/juju/errors"
@@ -12,11 +16,22 @@ import (
 
 type AsyncWatcher interface {
 	WatchAsync(context.Context, chan<- types.Message) <-chan error
+	// Ack acknowledges that the oldest unacknowledged message has been
+	// processed.
+	Ack()
+	// Persist persists the acknowledged state once the watch is done.
+	Persist()
 }
 
 // Pipeline starts a Watcher and feeds all message to the Processor.
 type Pipeline struct {
-	params Params
+	params    Params
+	dropped   uint64 // dropped is the number of messages dropped by the buffer.
+	heartbeat int64  // heartbeat is the UnixNano time of the last loop iteration.
+
+	mu           sync.Mutex
+	newProcessor processor.Factory
+	swapCh       chan struct{} // swapCh requests the processor to be swapped.
 }
 
 // Params contains parameters for NewPipeline.
@@ -24,53 +39,446 @@ type Params struct {
 	Logger       log.Logger        // Logger is used for logging errors.
 	Watcher      AsyncWatcher      // Watcher is used to start watching.
 	NewProcessor processor.Factory // NewProcessor creates a processor for all message.
-	BufferSize   int               // BufferSize is the message buffer size. Defaults to 0.
+	Buffer       Buffer            // Buffer configures buffering between the Watcher and Processor.
+	Time         Time              // Time configures the ticks sent to the Processor.
+	// Persister, when set, is used to restore and save the state of processors
+	// implementing types.Snapshotter. Optional.
+	Persister types.Persister
+	ReaderID  types.ReaderID // ReaderID is used as the key for processor state.
+	// ShutdownGrace is the time the buffered messages are still processed
+	// after the context is done. The messages not processed in time are not
+	// acknowledged, so they are read again on the next start. Defaults to
+	// DefaultShutdownGrace.
+	ShutdownGrace time.Duration
+	Metrics       *metrics.Metrics // Metrics to record, optional.
+	// Children reports the heartbeats of the pipelines run by the reader,
+	// optional.
+	Children types.ChildHeartbeater
 }
 
 // New creates a new instance of Pipeline.
 func New(params Params) *Pipeline {
+	params.Time = params.Time.withDefaults()
+
+	if params.ShutdownGrace <= 0 {
+		params.ShutdownGrace = DefaultShutdownGrace
+	}
+
 	return &Pipeline{
-		params: params,
+		params:       params,
+		newProcessor: params.NewProcessor,
+		swapCh:       make(chan struct{}, 1),
+	}
+}
+
+// ProcessorFactory returns the factory used to create the processor.
+func (p *Pipeline) ProcessorFactory() processor.Factory {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.newProcessor
+}
+
+// SetProcessorFactory replaces the factory used to create the processor.
+// When the pipeline is running, the processor is swapped in place without
+// restarting the watch, and its state is moved to the new processor when
+// possible.
+func (p *Pipeline) SetProcessorFactory(newProcessor processor.Factory) {
+	p.mu.Lock()
+	p.newProcessor = newProcessor
+	p.mu.Unlock()
+
+	select {
+	case p.swapCh <- struct{}{}:
+	default:
+	}
+}
+
+// Dropped returns the total number of messages dropped due to
+// OverloadDrop.
+func (p *Pipeline) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Heartbeat returns the last time the pipeline processed a message or a
+// tick. Since ticks are sent even when no messages are read, a heartbeat
+// older than a few tick intervals means that the processing is stuck. It
+// returns the zero time before ProcessPipeline is called.
+func (p *Pipeline) Heartbeat() time.Time {
+	nanos := atomic.LoadInt64(&p.heartbeat)
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+// progresser is implemented by watchers that report the progress of the
+// reader, e.g. watcher.Watcher.
+type progresser interface {
+	Progress() time.Time
+}
+
+// Progress returns the last time the reader delivered a message or reported
+// that it is waiting for new ones. Unlike Heartbeat, it is not updated by the
+// ticks, so it shows whether the reader itself is stuck. It returns the zero
+// time when the Watcher does not report the progress.
+func (p *Pipeline) Progress() time.Time {
+	if w, ok := p.params.Watcher.(progresser); ok {
+		return w.Progress()
+	}
+
+	return time.Time{}
+}
+
+// beat records a heartbeat at now.
+func (p *Pipeline) beat(now time.Time) {
+	atomic.StoreInt64(&p.heartbeat, now.UnixNano())
+}
+
+// Assert that Pipeline implements types.ChildHeartbeater.
+var _ types.ChildHeartbeater = &Pipeline{}
+
+// ChildHeartbeats implements types.ChildHeartbeater. It returns nil when the
+// reader runs no pipelines of its own.
+func (p *Pipeline) ChildHeartbeats() map[types.ReaderID]time.Time {
+	if p.params.Children == nil {
+		return nil
+	}
+
+	return p.params.Children.ChildHeartbeats()
+}
+
+// ReaderID returns the ID of the reader.
+func (p *Pipeline) ReaderID() types.ReaderID {
+	return p.params.ReaderID
+}
+
+// SnapshotKey returns the key under which the processor state of the reader
+// is persisted.
+func SnapshotKey(readerID types.ReaderID) string {
+	return "processors_" + string(readerID)
+}
+
+// restoreProcessor restores the persisted processor state. Failures are only
+// logged because a stale or corrupt snapshot should not prevent reading.
+func (p *Pipeline) restoreProcessor(ctx context.Context, processor types.Processor) {
+	snapshotter, ok := processor.(types.Snapshotter)
+	if !ok || p.params.Persister == nil {
+		return
+	}
+
+	data, err := p.params.Persister.LoadData(ctx, SnapshotKey(p.params.ReaderID))
+	if err != nil {
+		p.params.Logger.Error("Failed to load processor state", err, nil)
+
+		return
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	if err := snapshotter.Restore(data); err != nil {
+		p.params.Logger.Error("Failed to restore processor state", err, nil)
+
+		return
+	}
+
+	p.params.Logger.Info("Restored processor state", nil)
+}
+
+// saveProcessor persists the processor state and returns true on success. It
+// uses a separate context so that the state can still be saved upon shutdown.
+func (p *Pipeline) saveProcessor(processor types.Processor) bool {
+	snapshotter, ok := processor.(types.Snapshotter)
+	if !ok || p.params.Persister == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := snapshotter.Snapshot()
+	if err != nil {
+		p.params.Logger.Error("Failed to snapshot processor state", err, nil)
+
+		return false
+	}
+
+	// Always save so that a previous snapshot is not restored again.
+	if err := p.params.Persister.SaveData(ctx, SnapshotKey(p.params.ReaderID), data); err != nil {
+		p.params.Logger.Error("Failed to save processor state", err, nil)
+
+		return false
+	}
+
+	p.params.Logger.Info("Saved processor state", nil)
+
+	return true
+}
+
+// closeProcessor closes the processor, waiting for the in-flight actions.
+func (p *Pipeline) closeProcessor(processor types.Processor) {
+	if closer, ok := processor.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			p.params.Logger.Error("Failed to close processor", err, nil)
+		}
+	}
+}
+
+// swapProcessor replaces the processor with one created by the current
+// factory. The old processor is kept when the new one cannot be created. The
+// messages still held by the old processor are released once its state has
+// been moved to the new one and persisted.
+func (p *Pipeline) swapProcessor(old types.Processor, acks *acks) types.Processor {
+	next, err := p.ProcessorFactory()()
+	if err != nil {
+		p.params.Logger.Error("Failed to create processor, keeping the old one", err, nil)
+
+		return old
 	}
+
+	p.closeProcessor(old)
+
+	if err := moveState(old, next); err != nil {
+		// The held messages are not acknowledged, so they are read again on
+		// the next start.
+		p.params.Logger.Error("Failed to move processor state, starting empty", err, nil)
+	} else if p.saveProcessor(next) {
+		// The held messages are in the saved state of the new processor.
+		acks.releaseAll()
+	}
+
+	p.params.Logger.Info("Swapped processor", nil)
+
+	return next
+}
+
+// moveState restores the snapshot of from into to, when both implement
+// types.Snapshotter.
+func moveState(from, to types.Processor) error {
+	src, ok := from.(types.Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	dst, ok := to.(types.Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	data, err := src.Snapshot()
+	if err != nil || len(data) == 0 {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(dst.Restore(data))
 }
 
-// ProcessPipeline starts the watch and feeds all messages to Processor.
+// ProcessPipeline starts the watch and feeds all messages to Processor. It
+// can be called again after it returns to continue from the persisted state.
+//
+// A message is acknowledged to the Watcher once the processor is done with it,
+// including the work it continues after ProcessMessage returns, see
+// types.Hold.
+//
+// Once ctx is done, the watch is stopped and the buffered messages are still
+// processed for at most ShutdownGrace. The Processor then receives a final
+// Tick to flush the pending groups and is closed, waiting for the in-flight
+// actions, before the processor state and then the reader state are
+// persisted.
 func (p *Pipeline) ProcessPipeline(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	processor, err := p.params.NewProcessor()
+	processCtx, cancelProcess := withGrace(ctx, p.params.ShutdownGrace)
+	defer cancelProcess()
+
+	clock := p.params.Time.Clock
+
+	p.beat(clock.Now())
+
+	// The processor is created with the current factory below.
+	select {
+	case <-p.swapCh:
+	default:
+	}
+
+	processor, err := p.ProcessorFactory()()
 	if err != nil {
 		return errors.Trace(err)
 	}
 
-	ch := make(chan types.Message, p.params.BufferSize)
+	p.restoreProcessor(processCtx, processor)
+
+	ch := make(chan types.Message)
 
 	errCh := p.params.Watcher.WatchAsync(ctx, ch)
 
-	tick := time.NewTicker(time.Second) // TODO make this configurable and mockable.
+	bufferCh := make(chan bufferEntry)
+
+	go newBuffer(p.params.Buffer, p.params.Logger, &p.dropped).run(ch, bufferCh)
+
+	ticker := clock.NewTicker(p.params.Time.TickInterval)
+	defer ticker.Stop()
+
+	eventTime := NewEventTime(p.params.Time.TickInterval)
+
+	eventMode := p.params.Time.Mode == TimeModeEvent
+
+	recordGroups := func() {
+		if grouper, ok := processor.(types.NamedGrouper); ok {
+			p.params.Metrics.OpenGroups(p.params.ReaderID, grouper.OpenGroupsByName())
+		}
+	}
+
+	tick := func(ts time.Time) {
+		if processCtx.Err() != nil {
+			// The grace period has expired, the pending groups are persisted
+			// with the processor state instead.
+			return
+		}
+
+		if err := processor.Tick(processCtx, ts); err != nil {
+			p.params.Logger.Error("Failed to send tick", err, nil)
+		}
+
+		recordGroups()
+	}
+
+	acks := newAcks()
+
+	ack := func() {
+		for n := acks.ready(); n > 0; n-- {
+			p.params.Watcher.Ack()
+		}
+	}
+
+	dropped := p.Dropped()
 
-	defer tick.Stop()
+	// abandoned is the number of messages not processed in the grace period.
+	abandoned := 0
 
 loop:
 	for {
+		p.beat(clock.Now())
+
+		// Swap first so that the messages read after SetProcessorFactory are
+		// processed by the new processor.
 		select {
-		case message, ok := <-ch:
+		case <-p.swapCh:
+			processor = p.swapProcessor(processor, acks)
+			ack()
+		default:
+		}
+
+		select {
+		case entry, ok := <-bufferCh:
 			if !ok {
 				break loop
 			}
 
-			if err := processor.ProcessMessage(ctx, message); err != nil {
-				// Do not exit if we fail to process. Doing so would just stop
-				// reading logs altogether.
-				p.params.Logger.Error("Failed to process message", err, nil)
+			if processCtx.Err() != nil {
+				// Keep receiving so that the buffer and the watcher can finish,
+				// but do not acknowledge the messages.
+				if entry.message != nil {
+					abandoned++
+				}
+
+				continue
+			}
+
+			if entry.message != nil {
+				if eventMode {
+					// Let the processors expire their windows before the message
+					// is processed.
+					if ts := eventTime.Message(entry.message.Timestamp, clock.Now()); !ts.IsZero() {
+						tick(ts)
+					}
+				}
+
+				ackEntry := acks.add()
+
+				if err := processor.ProcessMessage(types.WithHolder(processCtx, ackEntry), *entry.message); err != nil {
+					// Do not exit if we fail to process. Doing so would just stop
+					// reading logs altogether.
+					p.params.Logger.Error("Failed to process message", err, nil)
+				}
+
+				if processCtx.Err() != nil {
+					// The message was interrupted, so it is read again.
+					abandoned++
+
+					continue
+				}
+
+				ackEntry.done()
+
+				p.params.Metrics.MessageRead(p.params.ReaderID, *entry.message, clock.Now())
+				recordGroups()
 			}
-		case ts := <-tick.C:
-			if err := processor.Tick(ctx, ts); err != nil {
-				p.params.Logger.Error("Failed to send tick", err, nil)
+
+			acks.addProcessed(entry.dropped)
+			ack()
+		case <-acks.readyCh:
+			ack()
+		case <-p.swapCh:
+			processor = p.swapProcessor(processor, acks)
+			ack()
+		case ts := <-ticker.C():
+			if eventMode {
+				ts = eventTime.Idle(clock.Now())
+			}
+
+			if !ts.IsZero() {
+				tick(ts)
+			}
+
+			if d := p.Dropped(); d != dropped {
+				p.params.Logger.Warn("Dropped messages due to overload", log.Ctx{
+					"dropped": d - dropped,
+					"total":   d,
+				})
+
+				p.params.Metrics.MessagesDropped(p.params.ReaderID, d-dropped)
+
+				dropped = d
 			}
 		}
 	}
 
-	return errors.Trace(<-errCh)
+	if abandoned > 0 {
+		p.params.Logger.Warn("Shutdown grace period expired, messages will be read again", log.Ctx{
+			"abandoned": abandoned,
+		})
+	}
+
+	// Flush the pending groups.
+	ts := clock.Now()
+
+	if eventMode {
+		ts = eventTime.Now(ts)
+	}
+
+	if !ts.IsZero() {
+		tick(ts)
+	}
+
+	p.closeProcessor(processor)
+	ack()
+
+	if p.saveProcessor(processor) {
+		// The messages still held are in the saved state.
+		acks.releaseAll()
+		ack()
+	}
+
+	err = <-errCh
+
+	// The reader state is persisted last, so that a crash while flushing reads
+	// the flushed messages again.
+	p.params.Watcher.Persist()
+
+	return errors.Trace(err)
 }
@@ -2,6 +2,7 @@ package pipeline_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/juju/errors"
 	"github.com/peer-calls/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPipeline(t *testing.T) {
@@ -58,7 +60,6 @@ func TestPipeline(t *testing.T) {
 		Logger:       log.New(),
 		Watcher:      w,
 		NewProcessor: newProcessor,
-		BufferSize:   0,
 	})
 
 	errCh := make(chan error, 1)
@@ -102,3 +103,141 @@ func MustMatcher(cfg *config.Matcher) types.Matcher {
 
 	return m
 }
+
+// counter is a processor that counts the messages and keeps the count in
+// its snapshot.
+type counter struct {
+	count int
+	ch    chan int
+}
+
+func (c *counter) ProcessMessage(ctx context.Context, message types.Message) error {
+	c.count++
+	c.ch <- c.count
+
+	return nil
+}
+
+func (c *counter) Tick(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+func (c *counter) Snapshot() ([]byte, error) {
+	return json.Marshal(c.count)
+}
+
+func (c *counter) Restore(data []byte) error {
+	return json.Unmarshal(data, &c.count)
+}
+
+func TestPipeline_SetProcessorFactory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reader := mock.NewReader("test")
+
+	first := &counter{ch: make(chan int, 10)}
+	second := &counter{ch: make(chan int, 10)}
+
+	p := persister.NewFile(t.TempDir())
+
+	pline := pipeline.New(pipeline.Params{
+		Logger: log.New(),
+		Watcher: watcher.New(watcher.Params{
+			Logger:    log.New(),
+			Persister: persister.NewNoop(),
+			Reader:    reader,
+		}),
+		NewProcessor: func() (types.Processor, error) {
+			return first, nil
+		},
+		Persister: p,
+		ReaderID:  "test",
+	})
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- pline.ProcessPipeline(ctx)
+	}()
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	send := func() {
+		require.NoError(t, readCtx.MockMessage(ctx, types.NewMessage(time.Now(), "test", "a", nil)))
+	}
+
+	send()
+	send()
+
+	assert.Equal(t, 1, <-first.ch)
+	assert.Equal(t, 2, <-first.ch)
+
+	pline.SetProcessorFactory(func() (types.Processor, error) {
+		return second, nil
+	})
+
+	send()
+
+	// The count is moved to the new processor.
+	assert.Equal(t, 3, <-second.ch)
+
+	// The moved state is persisted before the held messages are released.
+	data, err := p.LoadData(ctx, pipeline.SnapshotKey("test"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(data))
+
+	readCtx.Close()
+	require.NoError(t, <-errCh)
+
+	assert.Empty(t, first.ch, "old processor should not receive messages after swap")
+}
+
+func TestPipeline_Heartbeat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := mock.NewClock(start)
+	reader := mock.NewReader("test")
+
+	pline := pipeline.New(pipeline.Params{
+		Logger: log.New(),
+		Watcher: watcher.New(watcher.Params{
+			Logger:    log.New(),
+			Persister: persister.NewNoop(),
+			Reader:    reader,
+		}),
+		NewProcessor: func() (types.Processor, error) {
+			return &counter{ch: make(chan int, 10)}, nil
+		},
+		Time: pipeline.Time{
+			Clock:        clock,
+			TickInterval: time.Second,
+		},
+	})
+
+	assert.True(t, pline.Heartbeat().IsZero())
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- pline.ProcessPipeline(ctx)
+	}()
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	assert.True(t, start.Equal(pline.Heartbeat()))
+
+	// Idle pipelines keep beating on ticks.
+	clock.Add(time.Second)
+
+	assert.Eventually(t, func() bool {
+		return pline.Heartbeat().Equal(start.Add(time.Second))
+	}, time.Second, time.Millisecond)
+
+	readCtx.Close()
+	require.NoError(t, <-errCh)
+}
@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultShutdownGrace is the default Params.ShutdownGrace.
+const DefaultShutdownGrace = 10 * time.Second
+
+// withGrace returns a context that is only done once grace has passed after
+// ctx is done, or when the returned cancel is called. It is used to drain and
+// flush the processors after the watch has been stopped.
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-graceCtx.Done():
+			return
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-graceCtx.Done():
+		}
+	}()
+
+	return graceCtx, cancel
+}
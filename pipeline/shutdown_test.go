@@ -0,0 +1,207 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/types"
+	"github.com/jeremija/taily/watcher"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gated is a processor that does not finish processing a message until the
+// gate is closed or ctx is done.
+type gated struct {
+	started chan struct{}
+	gate    chan struct{}
+	ch      chan event
+}
+
+func newGated() gated {
+	return gated{
+		started: make(chan struct{}, 10),
+		gate:    make(chan struct{}),
+		ch:      make(chan event, 10),
+	}
+}
+
+func (g gated) ProcessMessage(ctx context.Context, message types.Message) error {
+	g.started <- struct{}{}
+
+	select {
+	case <-g.gate:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	g.ch <- event{text: message.Text()}
+
+	return nil
+}
+
+func (g gated) Tick(ctx context.Context, now time.Time) error {
+	g.ch <- event{tick: now}
+
+	return nil
+}
+
+// events returns all recorded events.
+func (g gated) events() []event {
+	close(g.ch)
+
+	var events []event
+
+	for ev := range g.ch {
+		events = append(events, ev)
+	}
+
+	return events
+}
+
+// flushPersister records the number of processed events whenever the reader
+// state is saved.
+type flushPersister struct {
+	types.Persister
+	events    chan event
+	numEvents []int
+}
+
+func (p *flushPersister) SaveState(ctx context.Context, readerID types.ReaderID, state types.State) error {
+	p.numEvents = append(p.numEvents, len(p.events))
+
+	return p.Persister.SaveState(ctx, readerID, state)
+}
+
+func TestPipeline_Shutdown(t *testing.T) {
+	testCtx, testCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer testCancel()
+
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	wall := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newPipeline := func(p types.Persister, reader types.Reader, proc gated, grace time.Duration) *pipeline.Pipeline {
+		clock := mock.NewClock(wall)
+
+		return pipeline.New(pipeline.Params{
+			Logger: log.New(),
+			Watcher: watcher.New(watcher.Params{
+				Logger:        log.New(),
+				Persister:     p,
+				Reader:        reader,
+				Clock:         clock,
+				ShutdownGrace: grace,
+			}),
+			NewProcessor: func() (types.Processor, error) {
+				return proc, nil
+			},
+			Buffer: pipeline.Buffer{
+				Size: 10,
+			},
+			Time: pipeline.Time{
+				Clock: clock,
+			},
+			ShutdownGrace: grace,
+		})
+	}
+
+	t.Run("drain", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(testCtx)
+		defer cancel()
+
+		reader := mock.NewReader("test")
+		proc := newGated()
+		p := &flushPersister{
+			Persister: persister.NewFile(t.TempDir()),
+			events:    proc.ch,
+		}
+
+		pline := newPipeline(p, reader, proc, time.Minute)
+
+		errCh := make(chan error, 1)
+
+		go func() {
+			errCh <- pline.ProcessPipeline(ctx)
+		}()
+
+		readCtx, err := reader.Accept(ctx)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			message := types.NewMessage(t0.Add(time.Duration(i)*time.Second), "test", "a", nil)
+			require.NoError(t, readCtx.MockMessage(ctx, message))
+		}
+
+		<-proc.started
+
+		cancel()
+		close(proc.gate)
+
+		err = <-errCh
+		assert.True(t, types.IsError(err, context.Canceled), "expected context.Canceled, but got: %+v", err)
+
+		// The messages buffered before cancel are processed, followed by the
+		// final tick.
+		events := proc.events()
+		require.GreaterOrEqual(t, len(events), 2)
+
+		numMessages := len(events) - 1
+
+		for _, ev := range events[:numMessages] {
+			assert.Equal(t, event{text: "a"}, ev)
+		}
+
+		assert.Equal(t, event{tick: wall}, events[numMessages])
+
+		// The reader state is saved once, after the final tick.
+		assert.Equal(t, []int{len(events)}, p.numEvents)
+
+		state, err := p.LoadState(testCtx, "test")
+		require.NoError(t, err)
+
+		assert.Equal(t, t0.Add(time.Duration(numMessages-1)*time.Second), state.Timestamp)
+	})
+
+	t.Run("grace expired", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(testCtx)
+		defer cancel()
+
+		p := persister.NewFile(t.TempDir())
+		reader := mock.NewReader("test")
+		proc := newGated()
+
+		pline := newPipeline(p, reader, proc, 50*time.Millisecond)
+
+		errCh := make(chan error, 1)
+
+		go func() {
+			errCh <- pline.ProcessPipeline(ctx)
+		}()
+
+		readCtx, err := reader.Accept(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, readCtx.MockMessage(ctx, types.NewMessage(t0, "test", "a", nil)))
+
+		<-proc.started
+
+		cancel()
+
+		err = <-errCh
+		assert.True(t, types.IsError(err, context.Canceled), "expected context.Canceled, but got: %+v", err)
+
+		// Nothing is processed or flushed.
+		assert.Empty(t, proc.events())
+
+		// The interrupted message is not acknowledged.
+		state, err := p.LoadState(testCtx, "test")
+		require.NoError(t, err)
+
+		assert.Equal(t, types.State{}, state)
+	})
+}
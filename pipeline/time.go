@@ -0,0 +1,132 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/jeremija/taily/clock"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// DefaultTickInterval is the default Time.TickInterval.
+const DefaultTickInterval = time.Second
+
+// TimeMode describes the time passed to types.Processor.Tick.
+type TimeMode string
+
+// Values for TimeMode.
+const (
+	// TimeModeProcessing ticks with the Clock time. This is the default.
+	TimeModeProcessing TimeMode = "processing"
+	// TimeModeEvent ticks with the time derived from Message.Timestamp, so
+	// that time windows are correct when old messages are replayed. Ticks are
+	// sent whenever the message timestamps advance by TickInterval. While no
+	// messages arrive, the event time advances with the Clock.
+	TimeModeEvent TimeMode = "event"
+)
+
+// Time contains the time configuration of a Pipeline.
+type Time struct {
+	Clock        types.Clock   // Clock to use. Defaults to the system clock.
+	TickInterval time.Duration // TickInterval between ticks. Defaults to DefaultTickInterval.
+	Mode         TimeMode      // Mode is the time mode. Defaults to TimeModeProcessing.
+}
+
+// Validate returns an error when the Mode is not known.
+func (t Time) Validate() error {
+	switch t.Mode {
+	case "", TimeModeProcessing, TimeModeEvent:
+		return nil
+	default:
+		return errors.Errorf("unknown time mode: %q", t.Mode)
+	}
+}
+
+// withDefaults returns a copy of t with defaults set.
+func (t Time) withDefaults() Time {
+	if t.Clock == nil {
+		t.Clock = clock.New()
+	}
+
+	if t.TickInterval <= 0 {
+		t.TickInterval = DefaultTickInterval
+	}
+
+	if t.Mode == "" {
+		t.Mode = TimeModeProcessing
+	}
+
+	return t
+}
+
+// EventTime tracks the event time in TimeModeEvent. It is exported so that
+// the rules can be tested with the same ticks as in the pipeline.
+type EventTime struct {
+	interval  time.Duration
+	watermark time.Time // watermark is the latest message timestamp.
+	arrival   time.Time // arrival is the Clock time the watermark advanced.
+	tick      time.Time // tick is the event time of the last tick.
+}
+
+// NewEventTime creates a new instance of EventTime that ticks every
+// interval.
+func NewEventTime(interval time.Duration) *EventTime {
+	if interval <= 0 {
+		interval = DefaultTickInterval
+	}
+
+	return &EventTime{
+		interval: interval,
+	}
+}
+
+// Message advances the watermark with the message timestamp. It returns the
+// time to tick with, or zero time when it is not yet time to tick.
+func (e *EventTime) Message(ts time.Time, now time.Time) time.Time {
+	if !ts.After(e.watermark) {
+		return time.Time{}
+	}
+
+	e.watermark = ts
+	e.arrival = now
+
+	return e.advance(ts)
+}
+
+// Idle advances the event time with the Clock while no messages arrive. It
+// returns the time to tick with, or zero time when it is not yet time to
+// tick.
+func (e *EventTime) Idle(now time.Time) time.Time {
+	if e.watermark.IsZero() {
+		return time.Time{}
+	}
+
+	return e.advance(e.Now(now))
+}
+
+// Now returns the current event time, or zero time when no messages have
+// been received.
+func (e *EventTime) Now(now time.Time) time.Time {
+	if e.watermark.IsZero() {
+		return time.Time{}
+	}
+
+	return e.watermark.Add(now.Sub(e.arrival))
+}
+
+// advance returns ts when at least interval has passed since the last tick.
+func (e *EventTime) advance(ts time.Time) time.Time {
+	if e.tick.IsZero() {
+		e.tick = ts
+
+		return time.Time{}
+	}
+
+	if ts.Sub(e.tick) < e.interval {
+		return time.Time{}
+	}
+
+	e.tick = ts
+
+	return ts
+}
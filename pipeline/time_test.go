@@ -0,0 +1,158 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/types"
+	"github.com/jeremija/taily/watcher"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// event is either a processed message text or a tick.
+type event struct {
+	text string
+	tick time.Time
+}
+
+// recorder is a processor that records all events.
+type recorder struct {
+	ch chan event
+}
+
+func (r recorder) ProcessMessage(ctx context.Context, message types.Message) error {
+	r.ch <- event{text: message.Text()}
+
+	return nil
+}
+
+func (r recorder) Tick(ctx context.Context, now time.Time) error {
+	r.ch <- event{tick: now}
+
+	return nil
+}
+
+func TestPipeline_Time(t *testing.T) {
+	t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	wall := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type step struct {
+		message *time.Time    // message to send, if set.
+		advance time.Duration // clock advance, if set.
+		want    []event
+	}
+
+	at := func(d time.Duration) *time.Time {
+		ts := t0.Add(d)
+
+		return &ts
+	}
+
+	testCases := []struct {
+		name  string
+		mode  pipeline.TimeMode
+		steps []step
+		final time.Time // final tick upon shutdown.
+	}{
+		{
+			name: "processing",
+			mode: pipeline.TimeModeProcessing,
+			steps: []step{
+				{message: at(0), want: []event{{text: "a"}}},
+				{message: at(time.Hour), want: []event{{text: "a"}}},
+				{advance: time.Second, want: []event{{tick: wall.Add(time.Second)}}},
+			},
+			final: wall.Add(time.Second),
+		},
+		{
+			name: "event",
+			mode: pipeline.TimeModeEvent,
+			steps: []step{
+				{message: at(0), want: []event{{text: "a"}}},
+				{message: at(500 * time.Millisecond), want: []event{{text: "a"}}},
+				{message: at(2 * time.Second), want: []event{{tick: t0.Add(2 * time.Second)}, {text: "a"}}},
+				// Old messages do not move time backwards.
+				{message: at(time.Second), want: []event{{text: "a"}}},
+				// Event time advances with the clock while idle.
+				{advance: 3 * time.Second, want: []event{{tick: t0.Add(5 * time.Second)}}},
+			},
+			final: t0.Add(5 * time.Second),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			clock := mock.NewClock(wall)
+			reader := mock.NewReader("test")
+			rec := recorder{ch: make(chan event)}
+
+			pline := pipeline.New(pipeline.Params{
+				Logger: log.New(),
+				Watcher: watcher.New(watcher.Params{
+					Logger:    log.New(),
+					Persister: persister.NewNoop(),
+					Reader:    reader,
+					Clock:     clock,
+				}),
+				NewProcessor: func() (types.Processor, error) {
+					return rec, nil
+				},
+				Time: pipeline.Time{
+					Clock: clock,
+					Mode:  tc.mode,
+				},
+			})
+
+			errCh := make(chan error, 1)
+
+			go func() {
+				errCh <- pline.ProcessPipeline(ctx)
+			}()
+
+			readCtx, err := reader.Accept(ctx)
+			require.NoError(t, err)
+
+			for i, step := range tc.steps {
+				if step.message != nil {
+					message := types.NewMessage(*step.message, "test", "a", nil)
+					require.NoError(t, readCtx.MockMessage(ctx, message))
+				}
+
+				if step.advance > 0 {
+					clock.Add(step.advance)
+				}
+
+				for _, want := range step.want {
+					select {
+					case got := <-rec.ch:
+						assert.Equal(t, want, got, "step %d", i)
+					case <-ctx.Done():
+						t.Fatalf("step %d: timed out waiting for %v", i, want)
+					}
+				}
+			}
+
+			readCtx.Close()
+
+			select {
+			case got := <-rec.ch:
+				assert.Equal(t, event{tick: tc.final}, got, "final tick")
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for final tick")
+			}
+
+			require.NoError(t, <-errCh)
+		})
+	}
+}
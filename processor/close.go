@@ -0,0 +1,24 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jeremija/taily/types"
+)
+
+// closeAll closes all processors that implement io.Closer, even when some of
+// them fail.
+func closeAll(procs []types.Processor) error {
+	var errs []string
+
+	for _, proc := range procs {
+		if closer, ok := proc.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Sprintf("%+v", err))
+			}
+		}
+	}
+
+	return aggregateErrors("close failed", errs)
+}
@@ -0,0 +1,293 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Wildcard replaces the variable tokens in Cluster templates.
+const Wildcard = "<*>"
+
+// Defaults for ClusterParams.
+const (
+	DefaultSimilarity    = 0.5
+	DefaultClusterWarmup = time.Hour
+)
+
+// Cluster is a Processor that groups messages into templates using a
+// simplified Drain algorithm and performs the action only when a message does
+// not belong to any of the known templates. The known templates are persisted
+// so they survive restarts.
+//
+// When no templates have been persisted yet, the templates are only learned
+// during the warmup, so that the first start does not report every message
+// as new. The end of the warmup is persisted with the templates, so a restart
+// continues the warmup instead of ending it.
+//
+// Cluster is safe for concurrent use so that a single instance can be shared
+// between pipelines.
+type Cluster struct {
+	params ClusterParams
+
+	mu        sync.Mutex
+	loaded    bool
+	dirty     bool
+	warmup    bool               // warmup is true while the templates are only learned.
+	warmupEnd time.Time          // warmupEnd is set by the first message of the warmup.
+	templates map[int][][]string // templates by number of tokens.
+}
+
+// ClusterParams contains parameters for NewCluster.
+type ClusterParams struct {
+	Persister types.Persister // Persister to load and store templates with.
+	Key       string          // Key under which templates are persisted.
+	Matcher   types.Matcher   // Matcher selects messages to cluster. Optional.
+	// Similarity is the minimum ratio of matching tokens required for a
+	// message to belong to a template. Defaults to DefaultSimilarity.
+	Similarity float64
+	// Warmup is the time, in message timestamps, during which the templates
+	// are only learned when none have been persisted yet. Defaults to
+	// DefaultClusterWarmup, a negative value disables the warmup.
+	Warmup time.Duration
+	Action types.Action // Action to perform when a new template is found.
+}
+
+// NewCluster creates a new instance of Cluster.
+func NewCluster(params ClusterParams) *Cluster {
+	if params.Similarity <= 0 {
+		params.Similarity = DefaultSimilarity
+	}
+
+	if params.Warmup == 0 {
+		params.Warmup = DefaultClusterWarmup
+	}
+
+	return &Cluster{
+		params:    params,
+		templates: map[int][][]string{},
+	}
+}
+
+// Assert that Cluster implements types.Processor and io.Closer.
+var (
+	_ types.Processor = &Cluster{}
+	_ io.Closer       = &Cluster{}
+)
+
+// Tokenize splits text into whitespace separated tokens and masks the ones
+// containing digits, since those are usually numbers, IDs or addresses.
+func Tokenize(text string) []string {
+	tokens := strings.Fields(text)
+
+	for i, token := range tokens {
+		if strings.IndexFunc(token, unicode.IsDigit) >= 0 {
+			tokens[i] = Wildcard
+		}
+	}
+
+	return tokens
+}
+
+// similarity returns the ratio of tokens matching the template.
+func similarity(template []string, tokens []string) float64 {
+	var equal int
+
+	for i, token := range tokens {
+		if template[i] == Wildcard || template[i] == token {
+			equal++
+		}
+	}
+
+	return float64(equal) / float64(len(tokens))
+}
+
+// clusterState is the persisted state of Cluster.
+type clusterState struct {
+	Templates []string `json:"templates"`
+	// WarmupEnd is set while the warmup has not ended yet.
+	WarmupEnd *time.Time `json:"warmup_end,omitempty"`
+}
+
+// load loads the persisted templates once.
+func (p *Cluster) load(ctx context.Context) error {
+	if p.loaded {
+		return nil
+	}
+
+	data, err := p.params.Persister.LoadData(ctx, p.params.Key)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var state clusterState
+
+	switch {
+	case data == nil:
+		p.warmup = p.params.Warmup > 0
+	case len(data) > 0 && data[0] == '[':
+		// The templates used to be persisted without the warmup.
+		if err := json.Unmarshal(data, &state.Templates); err != nil {
+			return errors.Trace(err)
+		}
+	default:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return errors.Trace(err)
+		}
+
+		if state.WarmupEnd != nil && p.params.Warmup > 0 {
+			p.warmup = true
+			p.warmupEnd = *state.WarmupEnd
+		}
+	}
+
+	for _, template := range state.Templates {
+		tokens := strings.Split(template, " ")
+
+		p.templates[len(tokens)] = append(p.templates[len(tokens)], tokens)
+	}
+
+	p.loaded = true
+
+	return nil
+}
+
+// save persists the templates when they have changed.
+func (p *Cluster) save(ctx context.Context) error {
+	if !p.dirty {
+		return nil
+	}
+
+	var state clusterState
+
+	for _, bucket := range p.templates {
+		for _, template := range bucket {
+			state.Templates = append(state.Templates, strings.Join(template, " "))
+		}
+	}
+
+	if p.warmup && !p.warmupEnd.IsZero() {
+		warmupEnd := p.warmupEnd
+		state.WarmupEnd = &warmupEnd
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := p.params.Persister.SaveData(ctx, p.params.Key, data); err != nil {
+		return errors.Trace(err)
+	}
+
+	p.dirty = false
+
+	return nil
+}
+
+// add adds tokens to the best matching template and returns true when a new
+// template had to be created.
+func (p *Cluster) add(tokens []string) bool {
+	bucket := p.templates[len(tokens)]
+
+	var (
+		best    []string
+		bestSim float64
+	)
+
+	for _, template := range bucket {
+		if sim := similarity(template, tokens); sim > bestSim {
+			best = template
+			bestSim = sim
+		}
+	}
+
+	if best == nil || bestSim < p.params.Similarity {
+		p.templates[len(tokens)] = append(bucket, tokens)
+		p.dirty = true
+
+		return true
+	}
+
+	for i, token := range tokens {
+		if best[i] != Wildcard && best[i] != token {
+			best[i] = Wildcard
+			p.dirty = true
+		}
+	}
+
+	return false
+}
+
+// warmingUp returns true while the templates are only learned.
+func (p *Cluster) warmingUp(ts time.Time) bool {
+	if !p.warmup {
+		return false
+	}
+
+	if p.warmupEnd.IsZero() {
+		p.warmupEnd = ts.Add(p.params.Warmup)
+	}
+
+	p.warmup = ts.Before(p.warmupEnd)
+
+	return p.warmup
+}
+
+// ProcessMessage implements types.Processor.
+func (p *Cluster) ProcessMessage(ctx context.Context, message types.Message) error {
+	if p.params.Matcher != nil && !p.params.Matcher.MatchMessage(message) {
+		return nil
+	}
+
+	tokens := Tokenize(message.Text())
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+
+	if err := p.load(ctx); err != nil {
+		p.mu.Unlock()
+
+		return errors.Trace(err)
+	}
+
+	isNew := p.add(tokens) && !p.warmingUp(message.Timestamp)
+
+	p.mu.Unlock()
+
+	if !isNew {
+		return nil
+	}
+
+	err := p.params.Action.PerformAction(ctx, []types.Message{message})
+
+	return errors.Trace(err)
+}
+
+// Tick implements types.Processor. It persists the templates when they have
+// changed.
+func (p *Cluster) Tick(ctx context.Context, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return errors.Trace(p.save(ctx))
+}
+
+// Close implements io.Closer. It persists the templates learned since the
+// last Tick. Since a Cluster is shared between pipelines, it remains usable
+// after Close.
+func (p *Cluster) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return errors.Trace(p.save(context.Background()))
+}
@@ -0,0 +1,146 @@
+package processor_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t,
+		[]string{"Connection", "to", "<*>", "failed", "after", "<*>"},
+		processor.Tokenize("Connection to 10.0.0.1:5432 failed after 3s"),
+	)
+}
+
+func TestCluster(t *testing.T) {
+	ctx := context.Background()
+	p := persister.NewFile(t.TempDir())
+	ts := time.Now()
+
+	newCluster := func(action types.Action) *processor.Cluster {
+		return processor.NewCluster(processor.ClusterParams{
+			Persister: p,
+			Key:       "test",
+			Matcher:   matcher.Substring("error"),
+			Action:    action,
+		})
+	}
+
+	process := func(c *processor.Cluster, texts ...string) {
+		for _, text := range texts {
+			err := c.ProcessMessage(ctx, types.NewMessage(ts, "test", text, nil))
+			require.NoError(t, err)
+		}
+	}
+
+	action := mock.NewAction()
+	c := newCluster(action)
+
+	// Nothing is persisted yet, so the first templates are only learned.
+	process(c,
+		"error: connection to db-1 refused",
+		"error: timeout",
+	)
+
+	assert.Empty(t, action.Texts())
+
+	ts = ts.Add(time.Hour)
+
+	process(c,
+		"error: connection to db-2 refused",
+		"error: connection to cache refused",
+		"request served in 3ms",
+		"error: disk full",
+	)
+
+	assert.Equal(t, [][]string{
+		{"error: disk full"},
+	}, action.Texts())
+
+	// The templates learned since the last tick are persisted when the
+	// pipeline closes its processors.
+	require.NoError(t, processor.Serial{c}.Close())
+
+	action = mock.NewAction()
+	c = newCluster(action)
+
+	process(c,
+		"error: connection to queue refused",
+		"error: disk full",
+		"error: timeout",
+		"error: permission denied",
+	)
+
+	assert.Equal(t, [][]string{
+		{"error: permission denied"},
+	}, action.Texts())
+}
+
+func TestCluster_warmup(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// run processes a new template at each offset with a new Cluster, as if
+	// restarted, and returns the texts of the performed actions.
+	run := func(t *testing.T, p types.Persister, warmup time.Duration, offsets ...time.Duration) []string {
+		t.Helper()
+
+		var ret []string
+
+		for i, offset := range offsets {
+			action := mock.NewAction()
+
+			c := processor.NewCluster(processor.ClusterParams{
+				Persister: p,
+				Key:       "test",
+				Warmup:    warmup,
+				Action:    action,
+			})
+
+			text := strings.Repeat("word ", i+1)
+
+			require.NoError(t, c.ProcessMessage(ctx, types.NewMessage(ts.Add(offset), "test", text, nil)))
+			require.NoError(t, c.Tick(ctx, ts.Add(offset)))
+
+			for _, texts := range action.Texts() {
+				ret = append(ret, texts...)
+			}
+		}
+
+		return ret
+	}
+
+	t.Run("restart during warmup", func(t *testing.T) {
+		p := persister.NewFile(t.TempDir())
+
+		texts := run(t, p, time.Hour, 0, 30*time.Minute, 2*time.Hour)
+
+		assert.Equal(t, []string{"word word word "}, texts)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		texts := run(t, persister.NewNoop(), -1, 0)
+
+		assert.Equal(t, []string{"word "}, texts)
+	})
+
+	t.Run("templates persisted without warmup", func(t *testing.T) {
+		p := persister.NewFile(t.TempDir())
+
+		require.NoError(t, p.SaveData(ctx, "test", []byte(`["error"]`)))
+
+		texts := run(t, p, time.Hour, 0)
+
+		assert.Equal(t, []string{"word "}, texts)
+	})
+}
@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"time"
+)
+
+// eventClock derives the current time in the time base of the message
+// timestamps, so that time windows started by messages can be compared with
+// it. The tick times only advance it while no newer messages arrive, so it
+// works the same in the processing and event time modes of the pipeline,
+// and replayed or lagging logs do not expire their windows at once.
+type eventClock struct {
+	watermark time.Time // watermark is the latest message timestamp.
+	arrival   time.Time // arrival is the tick time at which watermark advanced.
+	tick      time.Time // tick is the time of the last tick.
+}
+
+// message advances the watermark with the message timestamp.
+func (c *eventClock) message(ts time.Time) {
+	if !ts.After(c.watermark) {
+		return
+	}
+
+	c.watermark = ts
+
+	// A message cannot arrive before it is logged, so live messages use their
+	// own timestamp, while replayed ones use the last tick. Before the first
+	// tick, the arrival is set by it.
+	c.arrival = time.Time{}
+
+	if !c.tick.IsZero() {
+		c.arrival = c.tick
+
+		if ts.After(c.arrival) {
+			c.arrival = ts
+		}
+	}
+}
+
+// advance records the tick and returns the current event time, or zero time
+// when no messages have been received yet.
+func (c *eventClock) advance(now time.Time) time.Time {
+	c.tick = now
+
+	if c.watermark.IsZero() {
+		return time.Time{}
+	}
+
+	if c.arrival.IsZero() {
+		c.arrival = now
+	}
+
+	return c.watermark.Add(now.Sub(c.arrival))
+}
@@ -0,0 +1,33 @@
+package processor
+
+import "github.com/jeremija/taily/types"
+
+// openGroupsAll returns the sum of open groups of all processors that
+// implement types.Grouper.
+func openGroupsAll(procs []types.Processor) int {
+	var n int
+
+	for _, proc := range procs {
+		if grouper, ok := proc.(types.Grouper); ok {
+			n += grouper.OpenGroups()
+		}
+	}
+
+	return n
+}
+
+// openGroupsByNameAll returns the open groups of all named processors by
+// their name, see types.NamedGrouper.
+func openGroupsByNameAll(procs []types.Processor) map[string]int {
+	ret := map[string]int{}
+
+	for _, proc := range procs {
+		if grouper, ok := proc.(types.NamedGrouper); ok {
+			for name, n := range grouper.OpenGroupsByName() {
+				ret[name] += n
+			}
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,54 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenGroupsByName(t *testing.T) {
+	ctx := context.Background()
+
+	newProcessors := func() []types.Processor {
+		return []types.Processor{
+			processor.NewNamed("panics", processor.NewMatcher(processor.MatcherParams{
+				StartLine: matcher.Prefix("panic:"),
+				EndLine:   matcher.Not(matcher.Prefix("\t")),
+				Action:    mock.NewAction(),
+			})),
+			processor.NewNamed("all", processor.NewAny(mock.NewAction())),
+		}
+	}
+
+	want := map[string]int{
+		"panics": 1,
+		"all":    0,
+	}
+
+	message := types.NewMessage(time.Now(), "test", "panic: boom", nil)
+
+	serial := processor.Serial(newProcessors())
+	require.NoError(t, serial.ProcessMessage(ctx, message))
+	assert.Equal(t, want, serial.OpenGroupsByName())
+
+	parallel := processor.NewParallel(processor.ParallelParams{
+		Logger:     log.New(),
+		Processors: newProcessors(),
+	})
+
+	defer parallel.Close()
+
+	require.NoError(t, parallel.ProcessMessage(ctx, message))
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(want, parallel.OpenGroupsByName())
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Isolated implements Processor by processing the messages in sequence like
+// Serial, but an error in one processor does not prevent the subsequent
+// processors from seeing the message. All errors are aggregated.
+//
+// When a types.Transformer fails, the subsequent processors receive the
+// message as it was before the failed transformation.
+type Isolated []types.Processor
+
+// Assert that Isolated implements types.Processor.
+var _ types.Processor = Isolated{}
+
+// aggregateErrors returns an error containing all errs, or nil when empty.
+func aggregateErrors(msg string, errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errors.Errorf("%s: \n%s", msg, strings.Join(errs, "\n"))
+}
+
+// ProcessMessage implements types.Processor.
+func (p Isolated) ProcessMessage(ctx context.Context, message types.Message) error {
+	var errs []string
+
+	for _, proc := range p {
+		if transformer, ok := proc.(types.Transformer); ok {
+			transformed, err := transformer.TransformMessage(ctx, message)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%+v", err))
+			} else {
+				message = transformed
+			}
+		}
+
+		if err := proc.ProcessMessage(ctx, message); err != nil {
+			errs = append(errs, fmt.Sprintf("%+v", err))
+		}
+	}
+
+	return aggregateErrors("process failed", errs)
+}
+
+// Tick implements types.Processor.
+func (p Isolated) Tick(ctx context.Context, now time.Time) error {
+	var errs []string
+
+	for _, proc := range p {
+		if err := proc.Tick(ctx, now); err != nil {
+			errs = append(errs, fmt.Sprintf("%+v", err))
+		}
+	}
+
+	return aggregateErrors("tick failed", errs)
+}
+
+// Assert that Isolated implements types.Snapshotter.
+var _ types.Snapshotter = Isolated{}
+
+// Snapshot implements types.Snapshotter.
+func (p Isolated) Snapshot() ([]byte, error) {
+	data, err := snapshotAll(p)
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter.
+func (p Isolated) Restore(data []byte) error {
+	return errors.Trace(restoreAll(p, data))
+}
+
+// Assert that Isolated implements types.Grouper.
+var _ types.Grouper = Isolated{}
+
+// OpenGroups implements types.Grouper.
+func (p Isolated) OpenGroups() int {
+	return openGroupsAll(p)
+}
+
+// Assert that Isolated implements types.NamedGrouper.
+var _ types.NamedGrouper = Isolated{}
+
+// OpenGroupsByName implements types.NamedGrouper.
+func (p Isolated) OpenGroupsByName() map[string]int {
+	return openGroupsByNameAll(p)
+}
+
+// Assert that Isolated implements io.Closer.
+var _ io.Closer = Isolated{}
+
+// Close implements io.Closer.
+func (p Isolated) Close() error {
+	return errors.Trace(closeAll(p))
+}
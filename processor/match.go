@@ -10,6 +10,16 @@ import (
 type match struct {
 	time     time.Time
 	messages []types.Message
+	releases []func() // releases the holds of the messages, see types.Hold.
+}
+
+// release releases the holds of all messages.
+func (m *match) release() {
+	for _, release := range m.releases {
+		release()
+	}
+
+	m.releases = nil
 }
 
 func groupKey(groupBy []string, message types.Message) string {
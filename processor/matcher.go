@@ -2,6 +2,7 @@ package processor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -39,10 +40,14 @@ func (p *Matcher) performAction(ctx context.Context, m *match) error {
 	// event loop.
 	err := p.params.Action.PerformAction(ctx, m.messages)
 
+	// Failed actions are not retried, so the messages are done either way.
+	m.release()
+
 	return errors.Trace(err)
 }
 
-// ProcessMessage implements Processor.
+// ProcessMessage implements Processor. The messages added to open groups are
+// held until the group is acted on, see types.Hold.
 func (p *Matcher) ProcessMessage(ctx context.Context, message types.Message) error {
 	key := groupKey(p.params.GroupBy, message)
 
@@ -50,7 +55,7 @@ func (p *Matcher) ProcessMessage(ctx context.Context, message types.Message) err
 	if !ok {
 		if p.params.StartLine.MatchMessage(message) {
 			m = &match{
-				time:     time.Now(), // TODO mock
+				time:     message.Timestamp,
 				messages: []types.Message{message},
 			}
 
@@ -60,6 +65,7 @@ func (p *Matcher) ProcessMessage(ctx context.Context, message types.Message) err
 				return nil
 			}
 
+			m.releases = append(m.releases, types.Hold(ctx))
 			p.matches[key] = m
 		}
 
@@ -79,6 +85,8 @@ func (p *Matcher) ProcessMessage(ctx context.Context, message types.Message) err
 	case isEnd:
 		delete(p.matches, key)
 		p.performAction(ctx, m)
+	default:
+		m.releases = append(m.releases, types.Hold(ctx))
 	}
 
 	return nil
@@ -102,3 +110,59 @@ func (p *Matcher) Tick(ctx context.Context, now time.Time) error {
 
 	return nil
 }
+
+// matchSnapshot is the serialized form of match.
+type matchSnapshot struct {
+	Time     time.Time       `json:"time"`
+	Messages []types.Message `json:"messages"`
+}
+
+// Assert that Matcher implements types.Snapshotter.
+var _ types.Snapshotter = &Matcher{}
+
+// Snapshot implements types.Snapshotter. It serializes the open matches.
+func (p *Matcher) Snapshot() ([]byte, error) {
+	if len(p.matches) == 0 {
+		return nil, nil
+	}
+
+	snapshot := make(map[string]matchSnapshot, len(p.matches))
+
+	for k, m := range p.matches {
+		snapshot[k] = matchSnapshot{
+			Time:     m.time,
+			Messages: m.messages,
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter.
+func (p *Matcher) Restore(data []byte) error {
+	var snapshot map[string]matchSnapshot
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return errors.Trace(err)
+	}
+
+	for k, m := range snapshot {
+		p.matches[k] = &match{
+			time:     m.Time,
+			messages: m.Messages,
+		}
+	}
+
+	return nil
+}
+
+// Assert that Matcher implements types.Grouper.
+var _ types.Grouper = &Matcher{}
+
+// OpenGroups implements types.Grouper. It returns the number of open
+// multiline matches.
+func (p *Matcher) OpenGroups() int {
+	return len(p.matches)
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Named is a Processor that wraps a Processor with the name it is configured
+// under. The compositions key the snapshot of a Named processor by its name
+// instead of its position, so the state is restored into the same processor
+// after the processors are reordered, added or removed.
+type Named struct {
+	name      string
+	processor types.Processor
+}
+
+// NewNamed creates a new instance of Named.
+func NewNamed(name string, processor types.Processor) *Named {
+	return &Named{
+		name:      name,
+		processor: processor,
+	}
+}
+
+// Assert that Named implements types.Processor and types.Transformer.
+var (
+	_ types.Processor   = &Named{}
+	_ types.Transformer = &Named{}
+)
+
+// Name returns the name of the processor.
+func (p *Named) Name() string {
+	return p.name
+}
+
+// ProcessMessage implements types.Processor.
+func (p *Named) ProcessMessage(ctx context.Context, message types.Message) error {
+	return errors.Trace(p.processor.ProcessMessage(ctx, message))
+}
+
+// TransformMessage implements types.Transformer. The message is returned
+// unmodified when the wrapped Processor is not a types.Transformer.
+func (p *Named) TransformMessage(ctx context.Context, message types.Message) (types.Message, error) {
+	transformer, ok := p.processor.(types.Transformer)
+	if !ok {
+		return message, nil
+	}
+
+	message, err := transformer.TransformMessage(ctx, message)
+
+	return message, errors.Trace(err)
+}
+
+// Tick implements types.Processor.
+func (p *Named) Tick(ctx context.Context, now time.Time) error {
+	return errors.Trace(p.processor.Tick(ctx, now))
+}
+
+// Assert that Named implements types.Snapshotter.
+var _ types.Snapshotter = &Named{}
+
+// Snapshot implements types.Snapshotter. It returns nil when the wrapped
+// Processor is not a types.Snapshotter.
+func (p *Named) Snapshot() ([]byte, error) {
+	snapshotter, ok := p.processor.(types.Snapshotter)
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := snapshotter.Snapshot()
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter.
+func (p *Named) Restore(data []byte) error {
+	snapshotter, ok := p.processor.(types.Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	return errors.Trace(snapshotter.Restore(data))
+}
+
+// Assert that Named implements types.Grouper and types.NamedGrouper.
+var (
+	_ types.Grouper      = &Named{}
+	_ types.NamedGrouper = &Named{}
+)
+
+// OpenGroups implements types.Grouper.
+func (p *Named) OpenGroups() int {
+	return openGroupsAll([]types.Processor{p.processor})
+}
+
+// OpenGroupsByName implements types.NamedGrouper. The processor is always
+// reported, even without open groups.
+func (p *Named) OpenGroupsByName() map[string]int {
+	return map[string]int{
+		p.name: p.OpenGroups(),
+	}
+}
+
+// Assert that Named implements io.Closer.
+var _ io.Closer = &Named{}
+
+// Close implements io.Closer.
+func (p *Named) Close() error {
+	return errors.Trace(closeAll([]types.Processor{p.processor}))
+}
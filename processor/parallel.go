@@ -0,0 +1,261 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// DefaultParallelBufferSize is the default ParallelParams.BufferSize.
+const DefaultParallelBufferSize = 100
+
+// Parallel implements Processor by fanning out messages to processors, each
+// running in its own goroutine with its own buffered channel. A slow
+// processor does not hold back the others while its buffer has room, but once
+// the buffer is full, sending blocks until it drains, so the other processors
+// wait too. Messages are never dropped. Errors are logged since the messages
+// are processed asynchronously.
+//
+// Processors implementing types.Transformer are applied in order in the
+// calling goroutine before the message is fanned out to the other processors.
+//
+// Close must be called to stop the goroutines.
+type Parallel struct {
+	params       ParallelParams
+	transformers []types.Transformer
+	workers      []*parallelWorker
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// ParallelParams contains parameters for NewParallel.
+type ParallelParams struct {
+	Logger     log.Logger        // Logger to log processing errors with.
+	Processors []types.Processor // Processors to fan out to.
+	BufferSize int               // BufferSize per processor. Defaults to DefaultParallelBufferSize.
+}
+
+// parallelEvent is either a message or a tick.
+type parallelEvent struct {
+	message *types.Message
+	holder  types.Holder // holder of the message, see types.Hold. Optional.
+	release func()       // release the hold of the message.
+	tick    time.Time
+}
+
+// parallelWorker processes events for a single processor.
+type parallelWorker struct {
+	processor  types.Processor
+	name       string // name of the processor when it is Named.
+	ch         chan parallelEvent
+	openGroups int64 // openGroups after the last event, updated atomically.
+}
+
+// NewParallel creates a new instance of Parallel and starts the goroutines.
+func NewParallel(params ParallelParams) *Parallel {
+	params.Logger = params.Logger.WithNamespaceAppended("parallel")
+
+	if params.BufferSize <= 0 {
+		params.BufferSize = DefaultParallelBufferSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &Parallel{
+		params: params,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for _, proc := range params.Processors {
+		if transformer, ok := proc.(types.Transformer); ok {
+			p.transformers = append(p.transformers, transformer)
+		}
+
+		w := &parallelWorker{
+			processor: proc,
+			ch:        make(chan parallelEvent, params.BufferSize),
+		}
+
+		if named, ok := proc.(*Named); ok {
+			w.name = named.Name()
+		}
+
+		p.workers = append(p.workers, w)
+
+		p.wg.Add(1)
+
+		go func() {
+			defer p.wg.Done()
+
+			p.work(w)
+		}()
+	}
+
+	return p
+}
+
+// Assert that Parallel implements types.Processor and io.Closer.
+var (
+	_ types.Processor = &Parallel{}
+	_ io.Closer       = &Parallel{}
+)
+
+// work processes events until the channel is closed.
+func (p *Parallel) work(w *parallelWorker) {
+	for ev := range w.ch {
+		p.handle(w, ev)
+
+		// The processor is not safe to use from other goroutines, so its
+		// open groups are recorded here.
+		atomic.StoreInt64(&w.openGroups, int64(openGroupsAll([]types.Processor{w.processor})))
+	}
+}
+
+// handle passes the event to the worker's processor.
+func (p *Parallel) handle(w *parallelWorker, ev parallelEvent) {
+	if ev.message != nil {
+		ctx := p.ctx
+
+		if ev.holder != nil {
+			ctx = types.WithHolder(ctx, ev.holder)
+
+			defer ev.release()
+		}
+
+		if err := w.processor.ProcessMessage(ctx, *ev.message); err != nil {
+			p.params.Logger.Error("Failed to process message", err, nil)
+		}
+
+		return
+	}
+
+	if err := w.processor.Tick(p.ctx, ev.tick); err != nil {
+		p.params.Logger.Error("Failed to send tick", err, nil)
+	}
+}
+
+// send sends the event to all workers in turn. It blocks while the buffer of
+// a worker is full. A message is held, see types.Hold, until every worker has
+// processed it.
+func (p *Parallel) send(ctx context.Context, ev parallelEvent) error {
+	if ev.message != nil {
+		ev.holder = types.HolderFromContext(ctx)
+	}
+
+	for _, w := range p.workers {
+		if ev.holder != nil {
+			ev.release = ev.holder.Hold()
+		}
+
+		select {
+		case w.ch <- ev:
+		case <-ctx.Done():
+			if ev.holder != nil {
+				ev.release()
+			}
+
+			return errors.Trace(ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+// ProcessMessage implements types.Processor. It returns once the message has
+// been queued for all processors, while the message is held until they have
+// processed it.
+func (p *Parallel) ProcessMessage(ctx context.Context, message types.Message) error {
+	for _, transformer := range p.transformers {
+		var err error
+
+		message, err = transformer.TransformMessage(ctx, message)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(p.send(ctx, parallelEvent{message: &message}))
+}
+
+// Tick implements types.Processor.
+func (p *Parallel) Tick(ctx context.Context, now time.Time) error {
+	return errors.Trace(p.send(ctx, parallelEvent{tick: now}))
+}
+
+// Close implements io.Closer. It waits for all queued events to be processed,
+// stops the goroutines and closes the processors. ProcessMessage and Tick must
+// not be called after Close.
+func (p *Parallel) Close() error {
+	var err error
+
+	p.once.Do(func() {
+		for _, w := range p.workers {
+			close(w.ch)
+		}
+
+		p.wg.Wait()
+		p.cancel()
+
+		err = closeAll(p.params.Processors)
+	})
+
+	return errors.Trace(err)
+}
+
+// Assert that Parallel implements types.Snapshotter.
+var _ types.Snapshotter = &Parallel{}
+
+// Snapshot implements types.Snapshotter. It must only be called after Close
+// so that the processors are no longer in use.
+func (p *Parallel) Snapshot() ([]byte, error) {
+	data, err := snapshotAll(p.params.Processors)
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter.
+func (p *Parallel) Restore(data []byte) error {
+	return errors.Trace(restoreAll(p.params.Processors, data))
+}
+
+// Assert that Parallel implements types.Grouper.
+var _ types.Grouper = &Parallel{}
+
+// OpenGroups implements types.Grouper. It returns the open groups after the
+// last processed event of each processor.
+func (p *Parallel) OpenGroups() int {
+	var n int64
+
+	for _, w := range p.workers {
+		n += atomic.LoadInt64(&w.openGroups)
+	}
+
+	return int(n)
+}
+
+// Assert that Parallel implements types.NamedGrouper.
+var _ types.NamedGrouper = &Parallel{}
+
+// OpenGroupsByName implements types.NamedGrouper. It returns the open groups
+// after the last processed event of each Named processor.
+func (p *Parallel) OpenGroupsByName() map[string]int {
+	ret := map[string]int{}
+
+	for _, w := range p.workers {
+		if w.name != "" {
+			ret[w.name] += int(atomic.LoadInt64(&w.openGroups))
+		}
+	}
+
+	return ret
+}
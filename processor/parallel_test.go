@@ -0,0 +1,81 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingProcessor struct {
+	processor.NoTick
+}
+
+func (failingProcessor) ProcessMessage(context.Context, types.Message) error {
+	return errors.Errorf("failed")
+}
+
+func TestIsolated(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	p := processor.Isolated{
+		processor.NewTransform([]processor.TransformOperation{
+			processor.TransformSet("a", "b"),
+		}),
+		failingProcessor{},
+		processor.NewAny(action),
+	}
+
+	err := p.ProcessMessage(ctx, types.NewMessage(time.Now(), "test", "hello", nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed")
+
+	calls := action.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "b", calls[0][0].Fields["a"])
+
+	err = processor.Serial{failingProcessor{}, processor.NewAny(action)}.
+		ProcessMessage(ctx, types.NewMessage(time.Now(), "test", "hello", nil))
+	assert.Error(t, err)
+	assert.Len(t, action.Calls(), 1)
+}
+
+func TestParallel(t *testing.T) {
+	ctx := context.Background()
+	action1 := mock.NewAction()
+	action2 := mock.NewAction()
+
+	p := processor.NewParallel(processor.ParallelParams{
+		Logger: log.New(),
+		Processors: []types.Processor{
+			processor.NewAny(action1),
+			failingProcessor{},
+			processor.NewTransform([]processor.TransformOperation{
+				processor.TransformSet("a", "b"),
+			}),
+			processor.NewAny(action2),
+		},
+	})
+
+	for _, text := range []string{"one", "two", "three"} {
+		err := p.ProcessMessage(ctx, types.NewMessage(time.Now(), "test", text, nil))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, p.Tick(ctx, time.Now()))
+	require.NoError(t, p.Close())
+
+	want := [][]string{{"one"}, {"two"}, {"three"}}
+
+	assert.Equal(t, want, action1.Texts())
+	assert.Equal(t, want, action2.Texts())
+	assert.Equal(t, "b", action1.Calls()[0][0].Fields["a"])
+}
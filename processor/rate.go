@@ -0,0 +1,448 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Defaults for RateParams.
+const (
+	DefaultRateInterval = time.Minute
+	DefaultRateAlpha    = 0.3
+	DefaultRateFactor   = 3
+	DefaultRateMinCount = 10
+	DefaultRateWarmup   = 5
+)
+
+// MaxRateSeasonSlots is the maximum number of intervals in a season.
+const MaxRateSeasonSlots = 10080
+
+// minRateBaseline is the baseline below which an idle key is forgotten.
+const minRateBaseline = 0.01
+
+// Rate is a Processor that counts messages per group key in fixed intervals
+// of the message timestamps and compares the counts against an
+// exponentially weighted moving average baseline, optionally per interval of
+// a season. The action is performed once when the count becomes Factor times
+// above (spike) or below (drop) the baseline, and again only after the count
+// has returned to the baseline.
+//
+// Since the messages are counted by their timestamps, replayed logs are
+// counted in the intervals they were logged in. Ticks only close the
+// intervals while no newer messages arrive.
+type Rate struct {
+	params RateParams
+	rates  map[string]*rate
+	// bucketStart is the start of the current interval in the time of the
+	// message timestamps, or zero time before the first message.
+	bucketStart time.Time
+	clock       eventClock
+}
+
+// RateParams contains parameters for NewRate.
+type RateParams struct {
+	GroupBy  []string      // Fields to group by.
+	Interval time.Duration // Interval to count messages in. Defaults to DefaultRateInterval.
+	Alpha    float64       // EWMA smoothing factor in (0, 1]. Defaults to DefaultRateAlpha.
+	Factor   float64       // Deviation factor that triggers the action. Defaults to DefaultRateFactor.
+	// MinCount is the minimum count (for spikes) or baseline (for drops)
+	// required to perform the action, so that low-volume keys are not noisy.
+	// Defaults to DefaultRateMinCount.
+	MinCount float64
+	// Warmup is the number of intervals to observe before the baseline is
+	// considered reliable. Defaults to DefaultRateWarmup.
+	Warmup int
+	// Season, when set, is the period of the traffic pattern, e.g. 24h. Each
+	// interval of the season then has its own baseline, learned from the
+	// same interval of the previous seasons, which is used once the interval
+	// has been observed in a previous season. It must be a multiple of
+	// Interval, with at most MaxRateSeasonSlots intervals. Optional.
+	Season time.Duration
+	Action types.Action // Action to perform when an anomaly is detected.
+}
+
+// rate contains the state for a single group key.
+type rate struct {
+	count    int
+	baseline float64
+	samples  int
+	// alerting is the direction of the anomaly the action was performed for,
+	// or empty when the count is within the baseline.
+	alerting string
+	// seasonal contains the baseline of each interval of the season, or -1
+	// when the interval has not been observed yet.
+	seasonal []float64
+	readerID types.ReaderID
+	fields   types.Fields // values of GroupBy fields.
+}
+
+// Values for the RateDirectionKey field.
+const (
+	RateDirectionSpike = "spike"
+	RateDirectionDrop  = "drop"
+)
+
+// Fields set on messages sent to the Action by Rate.
+const (
+	RateDirectionKey = "RATE_DIRECTION"
+	RateCountKey     = "RATE_COUNT"
+	RateBaselineKey  = "RATE_BASELINE"
+)
+
+// NewRate creates a new instance of Rate.
+func NewRate(params RateParams) (*Rate, error) {
+	if params.Interval <= 0 {
+		params.Interval = DefaultRateInterval
+	}
+
+	if params.Alpha <= 0 || params.Alpha > 1 {
+		params.Alpha = DefaultRateAlpha
+	}
+
+	if params.Factor <= 1 {
+		params.Factor = DefaultRateFactor
+	}
+
+	if params.MinCount <= 0 {
+		params.MinCount = DefaultRateMinCount
+	}
+
+	if params.Warmup <= 0 {
+		params.Warmup = DefaultRateWarmup
+	}
+
+	if params.Season < 0 || params.Season%params.Interval != 0 {
+		return nil, errors.Errorf("season %s is not a multiple of interval %s", params.Season, params.Interval)
+	}
+
+	if params.Season/params.Interval > MaxRateSeasonSlots {
+		return nil, errors.Errorf("season %s has more than %d intervals of %s",
+			params.Season, MaxRateSeasonSlots, params.Interval)
+	}
+
+	return &Rate{
+		params: params,
+		rates:  map[string]*rate{},
+	}, nil
+}
+
+// Assert that Rate implements types.Processor.
+var _ types.Processor = &Rate{}
+
+// ProcessMessage implements types.Processor. Messages older than the current
+// interval are counted in it.
+func (p *Rate) ProcessMessage(ctx context.Context, message types.Message) error {
+	p.clock.message(message.Timestamp)
+
+	err := p.advance(ctx, message.Timestamp)
+
+	key := groupKey(p.params.GroupBy, message)
+
+	r, ok := p.rates[key]
+	if !ok {
+		fields := make(types.Fields, len(p.params.GroupBy))
+
+		for _, fieldName := range p.params.GroupBy {
+			fields[fieldName] = message.Fields[fieldName]
+		}
+
+		r = &rate{
+			readerID: message.ReaderID,
+			fields:   fields,
+		}
+
+		if slots := p.seasonSlots(); slots > 0 {
+			r.seasonal = make([]float64, slots)
+
+			for i := range r.seasonal {
+				r.seasonal[i] = -1
+			}
+		}
+
+		p.rates[key] = r
+	}
+
+	r.count++
+
+	return errors.Trace(err)
+}
+
+// Tick implements types.Processor. It evaluates the counts of the intervals
+// that have passed.
+func (p *Rate) Tick(ctx context.Context, now time.Time) error {
+	now = p.clock.advance(now)
+	if now.IsZero() {
+		return nil
+	}
+
+	return errors.Trace(p.advance(ctx, now))
+}
+
+// advance evaluates the counts of all intervals that have ended at now, in
+// the time of the message timestamps.
+func (p *Rate) advance(ctx context.Context, now time.Time) error {
+	if p.bucketStart.IsZero() {
+		p.bucketStart = now.Truncate(p.params.Interval)
+
+		return nil
+	}
+
+	var errs []string
+
+	for !now.Before(p.bucketStart.Add(p.params.Interval)) {
+		errs = append(errs, p.evaluate(ctx)...)
+
+		p.bucketStart = p.bucketStart.Add(p.params.Interval)
+
+		if len(p.rates) == 0 {
+			// There is nothing to learn from the remaining intervals.
+			p.bucketStart = now.Truncate(p.params.Interval)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("tick failed: \n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// seasonSlots returns the number of intervals in a season, or 0 when
+// seasons are not used.
+func (p *Rate) seasonSlots() int {
+	return int(p.params.Season / p.params.Interval)
+}
+
+// seasonSlot returns the index of the interval starting at start in the
+// season.
+func (p *Rate) seasonSlot(start time.Time) int {
+	slots := int64(p.seasonSlots())
+
+	return int((start.UnixNano()/int64(p.params.Interval)%slots + slots) % slots)
+}
+
+// expected returns the baseline to compare the count of the interval
+// starting at start with.
+func (p *Rate) expected(r *rate, start time.Time) float64 {
+	if len(r.seasonal) == 0 {
+		return r.baseline
+	}
+
+	if seasonal := r.seasonal[p.seasonSlot(start)]; seasonal >= 0 {
+		return seasonal
+	}
+
+	return r.baseline
+}
+
+// anomaly returns the direction of the anomaly, if any.
+func (p *Rate) anomaly(r *rate, expected float64) string {
+	if r.samples < p.params.Warmup {
+		return ""
+	}
+
+	count := float64(r.count)
+
+	switch {
+	case count > expected*p.params.Factor && count >= p.params.MinCount:
+		return RateDirectionSpike
+	case count < expected/p.params.Factor && expected >= p.params.MinCount:
+		return RateDirectionDrop
+	default:
+		return ""
+	}
+}
+
+// learn updates the baselines of r with the count of the interval starting
+// at start.
+func (p *Rate) learn(r *rate, start time.Time) {
+	count := float64(r.count)
+
+	ewma := func(baseline float64) float64 {
+		return p.params.Alpha*count + (1-p.params.Alpha)*baseline
+	}
+
+	if r.samples == 0 {
+		r.baseline = count
+	} else {
+		r.baseline = ewma(r.baseline)
+	}
+
+	if len(r.seasonal) > 0 {
+		slot := p.seasonSlot(start)
+
+		if r.seasonal[slot] < 0 {
+			r.seasonal[slot] = count
+		} else {
+			r.seasonal[slot] = ewma(r.seasonal[slot])
+		}
+	}
+
+	r.samples++
+	r.count = 0
+}
+
+// idle returns true when r has no traffic to compare with anymore.
+func (p *Rate) idle(r *rate) bool {
+	if r.baseline >= minRateBaseline {
+		return false
+	}
+
+	for _, seasonal := range r.seasonal {
+		if seasonal >= minRateBaseline {
+			return false
+		}
+	}
+
+	return true
+}
+
+// evaluate checks the counts of the current interval for anomalies and
+// updates the baselines. It returns the errors of the actions performed.
+func (p *Rate) evaluate(ctx context.Context) []string {
+	var errs []string
+
+	start := p.bucketStart
+	end := start.Add(p.params.Interval)
+
+	for key, r := range p.rates {
+		expected := p.expected(r, start)
+
+		direction := p.anomaly(r, expected)
+
+		if direction != "" && direction != r.alerting {
+			message := p.newMessage(end, r, direction, expected)
+
+			if err := p.params.Action.PerformAction(ctx, []types.Message{message}); err != nil {
+				errs = append(errs, fmt.Sprintf("%+v", err))
+			}
+		}
+
+		r.alerting = direction
+
+		p.learn(r, start)
+
+		if p.idle(r) {
+			delete(p.rates, key)
+		}
+	}
+
+	return errs
+}
+
+// newMessage creates a message describing the anomaly.
+func (p *Rate) newMessage(now time.Time, r *rate, direction string, expected float64) types.Message {
+	extra := make(types.Fields, len(r.fields)+3)
+
+	for k, v := range r.fields {
+		extra[k] = v
+	}
+
+	extra[RateDirectionKey] = direction
+	extra[RateCountKey] = strconv.Itoa(r.count)
+	extra[RateBaselineKey] = strconv.FormatFloat(expected, 'f', 2, 64)
+
+	text := fmt.Sprintf("Message rate %s: %d messages in %s, expected %.2f",
+		direction, r.count, p.params.Interval, expected)
+
+	return types.NewMessage(now, r.readerID, text, extra)
+}
+
+// rateSnapshot is the serialized form of Rate.
+type rateSnapshot struct {
+	BucketStart time.Time                   `json:"bucket_start"`
+	Rates       map[string]rateSnapshotItem `json:"rates"`
+}
+
+// rateSnapshotItem is the serialized form of rate.
+type rateSnapshotItem struct {
+	Count    int            `json:"count"`
+	Baseline float64        `json:"baseline"`
+	Samples  int            `json:"samples"`
+	Alerting string         `json:"alerting,omitempty"`
+	Seasonal []float64      `json:"seasonal,omitempty"`
+	ReaderID types.ReaderID `json:"reader_id"`
+	Fields   types.Fields   `json:"fields"`
+}
+
+// Assert that Rate implements types.Snapshotter.
+var _ types.Snapshotter = &Rate{}
+
+// Snapshot implements types.Snapshotter. It serializes the counts and
+// baselines so they do not need to be learned again after a restart.
+func (p *Rate) Snapshot() ([]byte, error) {
+	if len(p.rates) == 0 {
+		return nil, nil
+	}
+
+	snapshot := rateSnapshot{
+		BucketStart: p.bucketStart,
+		Rates:       make(map[string]rateSnapshotItem, len(p.rates)),
+	}
+
+	for k, r := range p.rates {
+		snapshot.Rates[k] = rateSnapshotItem{
+			Count:    r.count,
+			Baseline: r.baseline,
+			Samples:  r.samples,
+			Alerting: r.alerting,
+			Seasonal: r.seasonal,
+			ReaderID: r.readerID,
+			Fields:   r.fields,
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter. Seasonal baselines are discarded
+// when the season has changed.
+func (p *Rate) Restore(data []byte) error {
+	var snapshot rateSnapshot
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return errors.Trace(err)
+	}
+
+	p.bucketStart = snapshot.BucketStart.Truncate(p.params.Interval)
+
+	slots := p.seasonSlots()
+
+	for k, r := range snapshot.Rates {
+		seasonal := r.Seasonal
+
+		if len(seasonal) != slots {
+			seasonal = make([]float64, slots)
+
+			for i := range seasonal {
+				seasonal[i] = -1
+			}
+		}
+
+		p.rates[k] = &rate{
+			count:    r.Count,
+			baseline: r.Baseline,
+			samples:  r.Samples,
+			alerting: r.Alerting,
+			seasonal: seasonal,
+			readerID: r.ReaderID,
+			fields:   r.Fields,
+		}
+	}
+
+	// Let the restored intervals end even when no new messages arrive.
+	if !p.bucketStart.IsZero() {
+		p.clock.message(p.bucketStart)
+	}
+
+	return nil
+}
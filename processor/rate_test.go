@@ -0,0 +1,216 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRate(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	p, err := processor.NewRate(processor.RateParams{
+		GroupBy:  []string{"SYSLOG_IDENTIFIER"},
+		Interval: time.Minute,
+		Warmup:   3,
+		Action:   action,
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, p.Tick(ctx, now))
+
+	interval := func(count int) {
+		for i := 0; i < count; i++ {
+			err := p.ProcessMessage(ctx, types.NewMessage(now, "test", "hello", types.Fields{
+				"SYSLOG_IDENTIFIER": "app",
+			}))
+			require.NoError(t, err)
+		}
+
+		now = now.Add(time.Minute)
+
+		require.NoError(t, p.Tick(ctx, now))
+	}
+
+	for i := 0; i < 5; i++ {
+		interval(100)
+	}
+
+	assert.Empty(t, action.Calls())
+
+	interval(500)
+
+	calls := action.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, types.Fields{
+		"MESSAGE":           "Message rate spike: 500 messages in 1m0s, expected 100.00",
+		"SYSLOG_IDENTIFIER": "app",
+		"RATE_DIRECTION":    "spike",
+		"RATE_COUNT":        "500",
+		"RATE_BASELINE":     "100.00",
+	}, calls[0][0].Fields)
+
+	interval(5)
+
+	calls = action.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, processor.RateDirectionDrop, calls[1][0].Fields[processor.RateDirectionKey])
+}
+
+func TestRate_rearm(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	p, err := processor.NewRate(processor.RateParams{
+		Interval: time.Minute,
+		Warmup:   3,
+		Action:   action,
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	interval := func(count int) {
+		for i := 0; i < count; i++ {
+			require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(now, "test", "hello", nil)))
+		}
+
+		now = now.Add(time.Minute)
+
+		require.NoError(t, p.Tick(ctx, now))
+	}
+
+	for i := 0; i < 5; i++ {
+		interval(100)
+	}
+
+	// The outage is reported once.
+	interval(0)
+	interval(0)
+	interval(0)
+
+	require.Len(t, action.Calls(), 1)
+
+	// The count is back within the baseline, so the next drop is reported.
+	interval(100)
+	interval(0)
+
+	calls := action.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, processor.RateDirectionDrop, calls[1][0].Fields[processor.RateDirectionKey])
+}
+
+func TestRate_replay(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	params := processor.RateParams{
+		Interval: time.Minute,
+		Warmup:   3,
+		Action:   action,
+	}
+
+	p, err := processor.NewRate(params)
+	require.NoError(t, err)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := now
+
+	require.NoError(t, p.Tick(ctx, now))
+
+	interval := func(p *processor.Rate, count int, tick time.Duration) {
+		for i := 0; i < count; i++ {
+			message := types.NewMessage(ts.Add(time.Duration(i)*100*time.Millisecond), "test", "hello", nil)
+			require.NoError(t, p.ProcessMessage(ctx, message))
+		}
+
+		ts = ts.Add(time.Minute)
+		now = now.Add(tick)
+
+		require.NoError(t, p.Tick(ctx, now))
+	}
+
+	for i := 0; i < 5; i++ {
+		interval(p, 100, time.Minute)
+	}
+
+	data, err := p.Snapshot()
+	require.NoError(t, err)
+
+	// After a restart ten minutes later, the logs written in the meantime
+	// are replayed within a second and counted in the intervals they were
+	// logged in.
+	p, err = processor.NewRate(params)
+	require.NoError(t, err)
+	require.NoError(t, p.Restore(data))
+
+	now = now.Add(10 * time.Minute)
+
+	for i := 0; i < 10; i++ {
+		interval(p, 100, 100*time.Millisecond)
+	}
+
+	assert.Empty(t, action.Calls())
+}
+
+func TestRate_season(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	_, err := processor.NewRate(processor.RateParams{
+		Interval: time.Minute,
+		Season:   90 * time.Second,
+		Action:   action,
+	})
+	require.Error(t, err)
+
+	p, err := processor.NewRate(processor.RateParams{
+		Interval: time.Minute,
+		Season:   4 * time.Minute,
+		Warmup:   3,
+		Action:   action,
+	})
+	require.NoError(t, err)
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, p.Tick(ctx, now))
+
+	season := func(counts ...int) {
+		for _, count := range counts {
+			for i := 0; i < count; i++ {
+				require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(now, "test", "hello", nil)))
+			}
+
+			now = now.Add(time.Minute)
+
+			require.NoError(t, p.Tick(ctx, now))
+		}
+	}
+
+	// The last interval of the first season is compared with the overall
+	// baseline.
+	season(100, 100, 100, 10)
+	require.Len(t, action.Calls(), 1)
+
+	// Once learned, the quiet interval is expected.
+	season(100, 100, 100, 10)
+	season(100, 100, 100, 10)
+	require.Len(t, action.Calls(), 1)
+
+	season(100, 100, 100, 100)
+
+	calls := action.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, processor.RateDirectionSpike, calls[1][0].Fields[processor.RateDirectionKey])
+	assert.Equal(t, "10.00", calls[1][0].Fields[processor.RateBaselineKey])
+}
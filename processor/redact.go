@@ -0,0 +1,271 @@
+package processor
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+)
+
+// DefaultRedactReplacement replaces the redacted values by default.
+const DefaultRedactReplacement = "[REDACTED]"
+
+// redactLogInterval is the minimum interval between two logged summaries.
+const redactLogInterval = time.Minute
+
+// Redactor finds and replaces sensitive values.
+type Redactor struct {
+	Name   string         // Name is used for counting redactions.
+	Regexp *regexp.Regexp // Regexp to find values with.
+	// Replacement for each match. It can reference submatches like
+	// regexp.Regexp.ReplaceAllString.
+	Replacement string
+	// Validate is an optional check for each match. Matches for which it
+	// returns false are not redacted.
+	Validate func(match string) bool
+}
+
+// BuiltinRedactors contains redactors for common secrets and PII.
+var BuiltinRedactors = map[string]Redactor{
+	"bearer": {
+		Name:        "bearer",
+		Regexp:      regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+		Replacement: "${1}" + DefaultRedactReplacement,
+	},
+	"url_password": {
+		Name:        "url_password",
+		Regexp:      regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+:)[^@\s/]+@`),
+		Replacement: "${1}" + DefaultRedactReplacement + "@",
+	},
+	"secret_param": {
+		Name:        "secret_param",
+		Regexp:      regexp.MustCompile(`(?i)\b((?:password|passwd|pwd|secret|token|api[_-]?key)["']?\s*[:=]\s*["']?)[^\s"'&,;]+`),
+		Replacement: "${1}" + DefaultRedactReplacement,
+	},
+	"email": {
+		Name:        "email",
+		Regexp:      regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: DefaultRedactReplacement,
+	},
+	"card_number": {
+		Name:        "card_number",
+		Regexp:      regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Replacement: DefaultRedactReplacement,
+		Validate:    luhn,
+	},
+}
+
+// BuiltinRedactorNames contains the names of BuiltinRedactors in the order
+// they should be applied.
+var BuiltinRedactorNames = []string{
+	"bearer",
+	"url_password",
+	"secret_param",
+	"email",
+	"card_number",
+}
+
+// luhn returns true when the digits in str pass the Luhn checksum.
+func luhn(str string) bool {
+	var (
+		sum    int
+		double bool
+	)
+
+	for i := len(str) - 1; i >= 0; i-- {
+		c := str[i]
+
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+
+		if double {
+			d *= 2
+
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// Redact is a Processor that masks sensitive values in message fields. Like
+// Transform, it does nothing on its own, but when used in Serial all the
+// subsequent processors, and therefore actions, receive the redacted message.
+// The processors listed before it receive the original message.
+//
+// Redact is safe for concurrent use so that a single instance can be shared
+// between pipelines.
+type Redact struct {
+	params RedactParams
+	counts []uint64
+
+	mu        sync.Mutex
+	logged    uint64
+	lastLogAt time.Time
+}
+
+// RedactParams contains parameters for NewRedact.
+type RedactParams struct {
+	Logger    log.Logger // Logger to periodically log redaction counts with.
+	Redactors []Redactor // Redactors to apply in order.
+	Fields    []string   // Fields to redact. All fields are redacted when empty.
+}
+
+// NewRedact creates a new instance of Redact.
+func NewRedact(params RedactParams) *Redact {
+	params.Logger = params.Logger.WithNamespaceAppended("redact")
+
+	redactors := make([]Redactor, len(params.Redactors))
+
+	for i, r := range params.Redactors {
+		if r.Replacement == "" {
+			r.Replacement = DefaultRedactReplacement
+		}
+
+		redactors[i] = r
+	}
+
+	params.Redactors = redactors
+
+	return &Redact{
+		params: params,
+		counts: make([]uint64, len(params.Redactors)),
+	}
+}
+
+// Assert that Redact implements types.Processor and types.Transformer.
+var (
+	_ types.Processor   = &Redact{}
+	_ types.Transformer = &Redact{}
+)
+
+// ProcessMessage implements types.Processor.
+func (p *Redact) ProcessMessage(ctx context.Context, message types.Message) error {
+	return nil
+}
+
+// redact applies all redactors to value.
+func (p *Redact) redact(value string) string {
+	for i, r := range p.params.Redactors {
+		value = p.replace(i, r, value)
+	}
+
+	return value
+}
+
+// replace replaces the matches of the redactor r with index i in value. The
+// replacement is expanded from the submatches found in the whole value, so
+// that the context around each match, e.g. word boundaries, is preserved.
+func (p *Redact) replace(i int, r Redactor, value string) string {
+	matches := r.Regexp.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value
+	}
+
+	var (
+		dst  []byte
+		last int
+	)
+
+	for _, submatches := range matches {
+		start, end := submatches[0], submatches[1]
+
+		dst = append(dst, value[last:start]...)
+		last = end
+
+		if r.Validate != nil && !r.Validate(value[start:end]) {
+			dst = append(dst, value[start:end]...)
+
+			continue
+		}
+
+		atomic.AddUint64(&p.counts[i], 1)
+
+		dst = r.Regexp.ExpandString(dst, r.Replacement, value, submatches)
+	}
+
+	dst = append(dst, value[last:]...)
+
+	return string(dst)
+}
+
+// TransformMessage implements types.Transformer.
+func (p *Redact) TransformMessage(ctx context.Context, message types.Message) (types.Message, error) {
+	fields := make(types.Fields, len(message.Fields))
+
+	for k, v := range message.Fields {
+		fields[k] = v
+	}
+
+	if len(p.params.Fields) == 0 {
+		for k, v := range fields {
+			fields[k] = p.redact(v)
+		}
+	} else {
+		for _, k := range p.params.Fields {
+			if v, ok := fields[k]; ok {
+				fields[k] = p.redact(v)
+			}
+		}
+	}
+
+	message.Fields = fields
+
+	return message, nil
+}
+
+// Counts returns the number of redactions performed by each redactor.
+func (p *Redact) Counts() map[string]uint64 {
+	ret := make(map[string]uint64, len(p.counts))
+
+	for i, r := range p.params.Redactors {
+		ret[r.Name] = atomic.LoadUint64(&p.counts[i])
+	}
+
+	return ret
+}
+
+// Tick implements types.Processor. It logs the redaction counts when they
+// have changed, at most once per redactLogInterval.
+func (p *Redact) Tick(ctx context.Context, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.lastLogAt) < redactLogInterval {
+		return nil
+	}
+
+	counts := p.Counts()
+
+	var total uint64
+
+	logCtx := make(log.Ctx, len(counts))
+
+	for name, count := range counts {
+		total += count
+		logCtx[name] = count
+	}
+
+	if total == p.logged {
+		return nil
+	}
+
+	p.logged = total
+	p.lastLogAt = now
+
+	p.params.Logger.Info("Redacted values", logCtx)
+
+	return nil
+}
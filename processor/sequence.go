@@ -0,0 +1,227 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Sequence is a Processor that correlates messages matching an ordered list
+// of steps within a time window. Sequences are tracked separately for each
+// group key. The windows are measured in the time of the message timestamps,
+// also on Tick.
+type Sequence struct {
+	params    SequenceParams
+	sequences map[string]*sequence
+	clock     eventClock
+}
+
+// SequenceParams contains parameters for NewSequence.
+type SequenceParams struct {
+	Steps   []SequenceStep // Steps to match in order. At least two are required.
+	Window  time.Duration  // Window in which all steps must be matched.
+	GroupBy []string       // Fields to group by.
+	Action  types.Action   // Action to perform with correlated messages.
+}
+
+// SequenceStep describes a single step of a Sequence.
+type SequenceStep struct {
+	Matcher types.Matcher // Matcher is required.
+	// Absent inverts the step: the action is performed when the step is NOT
+	// matched within the window, and the sequence is discarded when it is.
+	// Only the last step can be absent.
+	Absent bool
+}
+
+// sequence contains the state of a sequence being matched.
+type sequence struct {
+	start    time.Time
+	step     int
+	messages []types.Message
+}
+
+// NewSequence creates a new instance of Sequence.
+func NewSequence(params SequenceParams) *Sequence {
+	return &Sequence{
+		params:    params,
+		sequences: map[string]*sequence{},
+	}
+}
+
+// Assert that Sequence implements types.Processor.
+var _ types.Processor = &Sequence{}
+
+// expired returns true when the window of s has passed at now.
+func (p *Sequence) expired(s *sequence, now time.Time) bool {
+	return now.Sub(s.start) > p.params.Window
+}
+
+// expire is called for sequences that have timed out. It performs the action
+// only when the only remaining step is the one expected to be absent.
+func (p *Sequence) expire(ctx context.Context, s *sequence) error {
+	if s.step != len(p.params.Steps)-1 || !p.params.Steps[s.step].Absent {
+		return nil
+	}
+
+	err := p.params.Action.PerformAction(ctx, s.messages)
+
+	return errors.Trace(err)
+}
+
+// ProcessMessage implements types.Processor.
+func (p *Sequence) ProcessMessage(ctx context.Context, message types.Message) error {
+	p.clock.message(message.Timestamp)
+
+	key := groupKey(p.params.GroupBy, message)
+
+	s, ok := p.sequences[key]
+	if ok && p.expired(s, message.Timestamp) {
+		delete(p.sequences, key)
+
+		if err := p.expire(ctx, s); err != nil {
+			return errors.Trace(err)
+		}
+
+		ok = false
+	}
+
+	if !ok {
+		if p.params.Steps[0].Matcher.MatchMessage(message) {
+			p.sequences[key] = &sequence{
+				start:    message.Timestamp,
+				step:     1,
+				messages: []types.Message{message},
+			}
+		}
+
+		return nil
+	}
+
+	step := p.params.Steps[s.step]
+
+	if !step.Matcher.MatchMessage(message) {
+		return nil
+	}
+
+	if step.Absent {
+		delete(p.sequences, key)
+
+		return nil
+	}
+
+	s.messages = append(s.messages, message)
+	s.step++
+
+	if s.step < len(p.params.Steps) {
+		return nil
+	}
+
+	delete(p.sequences, key)
+
+	err := p.params.Action.PerformAction(ctx, s.messages)
+
+	return errors.Trace(err)
+}
+
+// Tick implements types.Processor.
+func (p *Sequence) Tick(ctx context.Context, now time.Time) error {
+	now = p.clock.advance(now)
+	if now.IsZero() {
+		return nil
+	}
+
+	var errs []string
+
+	for k, s := range p.sequences {
+		if !p.expired(s, now) {
+			continue
+		}
+
+		delete(p.sequences, k)
+
+		if err := p.expire(ctx, s); err != nil {
+			errs = append(errs, fmt.Sprintf("%+v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("tick failed: \n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// sequenceSnapshot is the serialized form of sequence.
+type sequenceSnapshot struct {
+	Start    time.Time       `json:"start"`
+	Step     int             `json:"step"`
+	Messages []types.Message `json:"messages"`
+}
+
+// Assert that Sequence implements types.Snapshotter.
+var _ types.Snapshotter = &Sequence{}
+
+// Snapshot implements types.Snapshotter. It serializes the sequences in
+// progress.
+func (p *Sequence) Snapshot() ([]byte, error) {
+	if len(p.sequences) == 0 {
+		return nil, nil
+	}
+
+	snapshot := make(map[string]sequenceSnapshot, len(p.sequences))
+
+	for k, s := range p.sequences {
+		snapshot[k] = sequenceSnapshot{
+			Start:    s.start,
+			Step:     s.step,
+			Messages: s.messages,
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter. Sequences which no longer fit the
+// configured steps are discarded.
+func (p *Sequence) Restore(data []byte) error {
+	var snapshot map[string]sequenceSnapshot
+
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return errors.Trace(err)
+	}
+
+	for k, s := range snapshot {
+		if s.Step < 1 || s.Step >= len(p.params.Steps) {
+			continue
+		}
+
+		p.sequences[k] = &sequence{
+			start:    s.Start,
+			step:     s.Step,
+			messages: s.Messages,
+		}
+
+		// Let the restored sequences expire even when no new messages arrive.
+		for _, message := range s.Messages {
+			p.clock.message(message.Timestamp)
+		}
+	}
+
+	return nil
+}
+
+// Assert that Sequence implements types.Grouper.
+var _ types.Grouper = &Sequence{}
+
+// OpenGroups implements types.Grouper. It returns the number of sequences
+// being matched.
+func (p *Sequence) OpenGroups() int {
+	return len(p.sequences)
+}
@@ -0,0 +1,110 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequence_followedBy(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	p := processor.NewSequence(processor.SequenceParams{
+		Steps: []processor.SequenceStep{
+			{Matcher: matcher.Substring("deploy started")},
+			{Matcher: matcher.Substring("health check failed")},
+		},
+		Window:  5 * time.Minute,
+		GroupBy: []string{"service"},
+		Action:  action,
+	})
+
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	process := func(offset time.Duration, service string, text string) {
+		err := p.ProcessMessage(ctx, types.NewMessage(ts.Add(offset), "test", text, types.Fields{
+			"service": service,
+		}))
+		require.NoError(t, err)
+	}
+
+	process(0, "a", "deploy started")
+	process(time.Second, "b", "deploy started")
+	process(time.Minute, "b", "health check failed")
+	process(10*time.Minute, "a", "health check failed")
+
+	assert.Equal(t, [][]string{
+		{"deploy started", "health check failed"},
+	}, action.Texts())
+	assert.Equal(t, "b", action.Calls()[0][1].Fields["service"])
+}
+
+func TestSequence_notFollowedBy(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	p := processor.NewSequence(processor.SequenceParams{
+		Steps: []processor.SequenceStep{
+			{Matcher: matcher.Substring("connection lost")},
+			{Matcher: matcher.Substring("reconnected"), Absent: true},
+		},
+		Window: 30 * time.Second,
+		Action: action,
+	})
+
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "connection lost", nil)))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts.Add(time.Second), "test", "reconnected", nil)))
+	require.NoError(t, p.Tick(ctx, ts.Add(time.Minute)))
+	assert.Empty(t, action.Calls())
+
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts.Add(2*time.Minute), "test", "connection lost", nil)))
+	require.NoError(t, p.Tick(ctx, ts.Add(2*time.Minute+10*time.Second)))
+	assert.Empty(t, action.Calls())
+
+	require.NoError(t, p.Tick(ctx, ts.Add(3*time.Minute)))
+	assert.Equal(t, [][]string{{"connection lost"}}, action.Texts())
+}
+
+func TestSequence_replay(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	p := processor.NewSequence(processor.SequenceParams{
+		Steps: []processor.SequenceStep{
+			{Matcher: matcher.Substring("connection lost")},
+			{Matcher: matcher.Substring("reconnected"), Absent: true},
+		},
+		Window: 30 * time.Second,
+		Action: action,
+	})
+
+	// Logs from an hour ago are processed with ticks in the processing time.
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := ts.Add(time.Hour)
+
+	require.NoError(t, p.Tick(ctx, now))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "connection lost", nil)))
+	require.NoError(t, p.Tick(ctx, now.Add(time.Second)))
+	assert.Empty(t, action.Calls(), "window should not expire at once")
+
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts.Add(10*time.Second), "test", "reconnected", nil)))
+	require.NoError(t, p.Tick(ctx, now.Add(time.Minute)))
+	assert.Empty(t, action.Calls(), "absent step was matched")
+
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts.Add(20*time.Second), "test", "connection lost", nil)))
+	require.NoError(t, p.Tick(ctx, now.Add(time.Minute+20*time.Second)))
+	assert.Empty(t, action.Calls())
+
+	require.NoError(t, p.Tick(ctx, now.Add(2*time.Minute)))
+	assert.Equal(t, [][]string{{"connection lost"}}, action.Texts())
+}
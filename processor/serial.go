@@ -2,6 +2,7 @@ package processor
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/jeremija/taily/types"
@@ -9,7 +10,8 @@ import (
 )
 
 // Serial implements Processor by procesing the messages in sequence until
-// the end, or until an error is reached.
+// the end, or until an error is reached. Processors implementing
+// types.Transformer modify the message for all subsequent processors.
 type Serial []types.Processor
 
 // Assert that Processors implements Processor.
@@ -18,6 +20,15 @@ var _ types.Processor = Serial{}
 // ProcessMessage implements Processor.
 func (p Serial) ProcessMessage(ctx context.Context, message types.Message) error {
 	for _, proc := range p {
+		if transformer, ok := proc.(types.Transformer); ok {
+			var err error
+
+			message, err = transformer.TransformMessage(ctx, message)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+
 		if err := proc.ProcessMessage(ctx, message); err != nil {
 			return errors.Trace(err)
 		}
@@ -36,3 +47,42 @@ func (p Serial) Tick(ctx context.Context, now time.Time) error {
 
 	return nil
 }
+
+// Assert that Serial implements types.Snapshotter.
+var _ types.Snapshotter = Serial{}
+
+// Snapshot implements types.Snapshotter.
+func (p Serial) Snapshot() ([]byte, error) {
+	data, err := snapshotAll(p)
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter.
+func (p Serial) Restore(data []byte) error {
+	return errors.Trace(restoreAll(p, data))
+}
+
+// Assert that Serial implements types.Grouper.
+var _ types.Grouper = Serial{}
+
+// OpenGroups implements types.Grouper.
+func (p Serial) OpenGroups() int {
+	return openGroupsAll(p)
+}
+
+// Assert that Serial implements types.NamedGrouper.
+var _ types.NamedGrouper = Serial{}
+
+// OpenGroupsByName implements types.NamedGrouper.
+func (p Serial) OpenGroupsByName() map[string]int {
+	return openGroupsByNameAll(p)
+}
+
+// Assert that Serial implements io.Closer.
+var _ io.Closer = Serial{}
+
+// Close implements io.Closer.
+func (p Serial) Close() error {
+	return errors.Trace(closeAll(p))
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// snapshotKey returns the key of the snapshot of proc at index i: the name of
+// a Named processor, or the index otherwise.
+func snapshotKey(i int, proc types.Processor) string {
+	if named, ok := proc.(*Named); ok {
+		return named.Name()
+	}
+
+	return strconv.Itoa(i)
+}
+
+// snapshotAll creates a snapshot of all processors that implement
+// types.Snapshotter, keyed by snapshotKey.
+func snapshotAll(procs []types.Processor) ([]byte, error) {
+	snapshots := map[string]json.RawMessage{}
+
+	for i, proc := range procs {
+		snapshotter, ok := proc.(types.Snapshotter)
+		if !ok {
+			continue
+		}
+
+		data, err := snapshotter.Snapshot()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if data != nil {
+			snapshots[snapshotKey(i, proc)] = data
+		}
+	}
+
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(snapshots)
+
+	return data, errors.Trace(err)
+}
+
+// restoreAll restores the snapshot created by snapshotAll. The snapshots that
+// do not belong to any of the processors are skipped, since they belong to
+// processors that have been removed or renamed. A snapshot that cannot be
+// restored does not prevent restoring the others.
+func restoreAll(procs []types.Processor, data []byte) error {
+	if data == nil {
+		return nil
+	}
+
+	var snapshots map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return errors.Trace(err)
+	}
+
+	var errs []string
+
+	for i, proc := range procs {
+		snapshotter, ok := proc.(types.Snapshotter)
+		if !ok {
+			continue
+		}
+
+		snapshot, ok := snapshots[snapshotKey(i, proc)]
+		if !ok || string(snapshot) == "null" {
+			continue
+		}
+
+		if err := snapshotter.Restore(snapshot); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %+v", snapshotKey(i, proc), err))
+		}
+	}
+
+	return aggregateErrors("restore failed", errs)
+}
@@ -0,0 +1,106 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/matcher"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newProcessor := func(action types.Action) processor.Serial {
+		return processor.Serial{
+			processor.NewAny(mock.NewAction()),
+			processor.NewMatcher(processor.MatcherParams{
+				StartLine: matcher.Prefix("panic:"),
+				EndLine:   matcher.Not(matcher.Prefix("\t")),
+				Action:    action,
+			}),
+			processor.NewSequence(processor.SequenceParams{
+				Steps: []processor.SequenceStep{
+					{Matcher: matcher.Prefix("panic:")},
+					{Matcher: matcher.String("restarted")},
+				},
+				Window: time.Minute,
+				Action: action,
+			}),
+		}
+	}
+
+	action := mock.NewAction()
+	p := newProcessor(action)
+
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "panic: boom", nil)))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "\tmain.go:1", nil)))
+
+	data, err := p.Snapshot()
+	require.NoError(t, err)
+	require.NotNil(t, data)
+
+	action = mock.NewAction()
+	p = newProcessor(action)
+
+	require.NoError(t, p.Restore(data))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "\tmain.go:2", nil)))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "restarted", nil)))
+
+	assert.Equal(t, [][]string{
+		{"panic: boom", "\tmain.go:1", "\tmain.go:2"},
+		{"panic: boom", "restarted"},
+	}, action.Texts())
+
+	data, err = p.Snapshot()
+	require.NoError(t, err)
+	assert.Nil(t, data)
+
+}
+
+func TestSnapshot_named(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newMatcher := func(prefix string, action types.Action) *processor.Named {
+		return processor.NewNamed(prefix, processor.NewMatcher(processor.MatcherParams{
+			StartLine: matcher.Prefix(prefix),
+			EndLine:   matcher.Not(matcher.Prefix("\t")),
+			Action:    action,
+		}))
+	}
+
+	action := mock.NewAction()
+	p := processor.Serial{
+		newMatcher("panic:", action),
+		newMatcher("fatal:", action),
+	}
+
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "panic: boom", nil)))
+
+	data, err := p.Snapshot()
+	require.NoError(t, err)
+
+	// The processors are reordered and a new one is added before them, so
+	// the snapshot is restored by name.
+	action = mock.NewAction()
+	p = processor.Serial{
+		newMatcher("error:", action),
+		newMatcher("fatal:", action),
+		newMatcher("panic:", action),
+	}
+
+	require.NoError(t, p.Restore(data))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "\tmain.go:1", nil)))
+	require.NoError(t, p.ProcessMessage(ctx, types.NewMessage(ts, "test", "done", nil)))
+
+	assert.Equal(t, [][]string{
+		{"panic: boom", "\tmain.go:1"},
+	}, action.Texts())
+}
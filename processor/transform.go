@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// Transform is a Processor that modifies message fields. It does nothing on
+// its own, but when used in Serial, all subsequent processors receive the
+// transformed message.
+type Transform struct {
+	NoTick
+
+	operations []TransformOperation
+}
+
+// TransformOperation modifies the fields of a message in place.
+type TransformOperation func(message *types.Message) error
+
+// NewTransform creates a new instance of Transform. The operations are
+// applied in order.
+func NewTransform(operations []TransformOperation) *Transform {
+	return &Transform{
+		operations: operations,
+	}
+}
+
+// Assert that Transform implements types.Processor and types.Transformer.
+var (
+	_ types.Processor   = &Transform{}
+	_ types.Transformer = &Transform{}
+)
+
+// ProcessMessage implements types.Processor.
+func (p *Transform) ProcessMessage(ctx context.Context, message types.Message) error {
+	return nil
+}
+
+// TransformMessage implements types.Transformer.
+func (p *Transform) TransformMessage(ctx context.Context, message types.Message) (types.Message, error) {
+	fields := make(types.Fields, len(message.Fields))
+
+	for k, v := range message.Fields {
+		fields[k] = v
+	}
+
+	message.Fields = fields
+
+	for _, op := range p.operations {
+		if err := op(&message); err != nil {
+			return message, errors.Trace(err)
+		}
+	}
+
+	return message, nil
+}
+
+// TransformRename moves the value of field from to field to. It does nothing
+// when field from does not exist.
+func TransformRename(from, to string) TransformOperation {
+	return func(message *types.Message) error {
+		if v, ok := message.Fields[from]; ok {
+			delete(message.Fields, from)
+			message.Fields[to] = v
+		}
+
+		return nil
+	}
+}
+
+// TransformCopy copies the value of field from to field to. It does nothing
+// when field from does not exist.
+func TransformCopy(from, to string) TransformOperation {
+	return func(message *types.Message) error {
+		if v, ok := message.Fields[from]; ok {
+			message.Fields[to] = v
+		}
+
+		return nil
+	}
+}
+
+// TransformDrop removes the field.
+func TransformDrop(field string) TransformOperation {
+	return func(message *types.Message) error {
+		delete(message.Fields, field)
+
+		return nil
+	}
+}
+
+// TransformSet sets the field to a constant value.
+func TransformSet(field, value string) TransformOperation {
+	return func(message *types.Message) error {
+		message.Fields[field] = value
+
+		return nil
+	}
+}
+
+// TransformFormat sets the field to the message formatted with formatter,
+// for example a formatter.Template.
+func TransformFormat(field string, formatter types.Formatter) TransformOperation {
+	return func(message *types.Message) error {
+		var buf bytes.Buffer
+
+		if err := formatter.Format(&buf, *message); err != nil {
+			return errors.Trace(err)
+		}
+
+		message.Fields[field] = buf.String()
+
+		return nil
+	}
+}
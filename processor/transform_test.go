@@ -0,0 +1,56 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/formatter"
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransform(t *testing.T) {
+	ctx := context.Background()
+	action := mock.NewAction()
+
+	tmpl, err := formatter.NewTemplate("{SYSLOG_IDENTIFIER}@{host}", formatter.WithQuotes(0, 0))
+	require.NoError(t, err)
+
+	p := processor.Serial{
+		processor.NewTransform([]processor.TransformOperation{
+			processor.TransformRename("container_name", "SYSLOG_IDENTIFIER"),
+			processor.TransformDrop("container_id"),
+			processor.TransformCopy("_HOSTNAME", "host"),
+			processor.TransformCopy("missing", "other"),
+			processor.TransformSet("env", "prod"),
+			processor.TransformFormat("source", tmpl),
+		}),
+		processor.NewAny(action),
+	}
+
+	message := types.NewMessage(time.Now(), "test", "hello", types.Fields{
+		"container_name": "/app",
+		"container_id":   "abc",
+		"_HOSTNAME":      "server1",
+	})
+
+	require.NoError(t, p.ProcessMessage(ctx, message))
+
+	calls := action.Calls()
+	require.Len(t, calls, 1)
+
+	assert.Equal(t, types.Fields{
+		"MESSAGE":           "hello",
+		"SYSLOG_IDENTIFIER": "/app",
+		"_HOSTNAME":         "server1",
+		"host":              "server1",
+		"env":               "prod",
+		"source":            "/app@server1",
+	}, calls[0][0].Fields)
+
+	assert.Equal(t, "abc", message.Fields["container_id"], "original message should not be modified")
+}
@@ -0,0 +1,105 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+)
+
+// When is a Processor that only passes messages matching a Matcher to the
+// wrapped Processor. Ticks are always passed.
+type When struct {
+	matcher   types.Matcher
+	processor types.Processor
+}
+
+// NewWhen creates a new instance of When.
+func NewWhen(matcher types.Matcher, processor types.Processor) *When {
+	return &When{
+		matcher:   matcher,
+		processor: processor,
+	}
+}
+
+// Assert that When implements types.Processor and types.Transformer.
+var (
+	_ types.Processor   = &When{}
+	_ types.Transformer = &When{}
+)
+
+// ProcessMessage implements types.Processor.
+func (p *When) ProcessMessage(ctx context.Context, message types.Message) error {
+	if !p.matcher.MatchMessage(message) {
+		return nil
+	}
+
+	err := p.processor.ProcessMessage(ctx, message)
+
+	return errors.Trace(err)
+}
+
+// TransformMessage implements types.Transformer. The message is returned
+// unmodified when it does not match, or when the wrapped Processor is not a
+// types.Transformer.
+func (p *When) TransformMessage(ctx context.Context, message types.Message) (types.Message, error) {
+	transformer, ok := p.processor.(types.Transformer)
+	if !ok || !p.matcher.MatchMessage(message) {
+		return message, nil
+	}
+
+	message, err := transformer.TransformMessage(ctx, message)
+
+	return message, errors.Trace(err)
+}
+
+// Tick implements types.Processor.
+func (p *When) Tick(ctx context.Context, now time.Time) error {
+	err := p.processor.Tick(ctx, now)
+
+	return errors.Trace(err)
+}
+
+// Assert that When implements types.Snapshotter.
+var _ types.Snapshotter = &When{}
+
+// Snapshot implements types.Snapshotter. It returns nil when the wrapped
+// Processor is not a types.Snapshotter.
+func (p *When) Snapshot() ([]byte, error) {
+	snapshotter, ok := p.processor.(types.Snapshotter)
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := snapshotter.Snapshot()
+
+	return data, errors.Trace(err)
+}
+
+// Restore implements types.Snapshotter.
+func (p *When) Restore(data []byte) error {
+	snapshotter, ok := p.processor.(types.Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	return errors.Trace(snapshotter.Restore(data))
+}
+
+// Assert that When implements types.Grouper.
+var _ types.Grouper = &When{}
+
+// OpenGroups implements types.Grouper.
+func (p *When) OpenGroups() int {
+	return openGroupsAll([]types.Processor{p.processor})
+}
+
+// Assert that When implements io.Closer.
+var _ io.Closer = &When{}
+
+// Close implements io.Closer.
+func (p *When) Close() error {
+	return errors.Trace(closeAll([]types.Processor{p.processor}))
+}
@@ -2,45 +2,142 @@ package reader
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
 	dtypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/jeremija/taily/metrics"
+	"github.com/jeremija/taily/persister"
 	"github.com/jeremija/taily/pipeline"
 	"github.com/jeremija/taily/processor"
+	"github.com/jeremija/taily/supervisor"
 	"github.com/jeremija/taily/types"
 	"github.com/jeremija/taily/watcher"
 	"github.com/juju/errors"
 	"github.com/peer-calls/log"
 )
 
+// DefaultDockerProbeInterval is the default DockerParams.ProbeInterval.
+const DefaultDockerProbeInterval = 30 * time.Second
+
 // Docker is a Reader that can read Docker events.
 type Docker struct {
 	params DockerParams
+
+	mu        sync.Mutex
+	pipelines map[types.ReaderID]*pipeline.Pipeline // pipelines of the containers being read.
 }
 
-// Assert that Docker implements types.Reader.
-var _ types.Reader = &Docker{}
+// Assert that Docker implements types.Reader and types.ChildHeartbeater.
+var (
+	_ types.Reader           = &Docker{}
+	_ types.ChildHeartbeater = &Docker{}
+)
 
 // NewDocker creates a new instance of Docker.
 func NewDocker(params DockerParams) *Docker {
 	params.Logger = params.Logger.WithNamespaceAppended("docker")
 
+	if params.Retention.Interval <= 0 {
+		params.Retention.Interval = persister.DefaultRetentionInterval
+	}
+
+	if params.ProbeInterval <= 0 {
+		params.ProbeInterval = DefaultDockerProbeInterval
+	}
+
 	params.Logger = types.LoggerWithReaderID(params.Logger, params.ReaderID)
+	params.Restart.Logger = params.Logger
 
 	return &Docker{
-		params: params,
+		params:    params,
+		pipelines: map[types.ReaderID]*pipeline.Pipeline{},
 	}
 }
 
+// ChildHeartbeats implements types.ChildHeartbeater. It returns the
+// heartbeats of the container pipelines that have started processing.
+func (d *Docker) ChildHeartbeats() map[types.ReaderID]time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ret := make(map[types.ReaderID]time.Time, len(d.pipelines))
+
+	for readerID, pline := range d.pipelines {
+		if heartbeat := pline.Heartbeat(); !heartbeat.IsZero() {
+			ret[readerID] = heartbeat
+		}
+	}
+
+	return ret
+}
+
+// containerRunner is a supervisor.Runner of a container pipeline.
+type containerRunner struct {
+	docker   *Docker
+	pipeline *pipeline.Pipeline
+}
+
+// ReaderID implements supervisor.Runner.
+func (r containerRunner) ReaderID() types.ReaderID {
+	return r.pipeline.ReaderID()
+}
+
+// ProcessPipeline implements supervisor.Runner.
+func (r containerRunner) ProcessPipeline(ctx context.Context) error {
+	return errors.Trace(r.docker.processContainer(ctx, r.pipeline))
+}
+
+// processContainer runs the container pipeline and reports its heartbeats
+// while it runs.
+func (d *Docker) processContainer(ctx context.Context, pline *pipeline.Pipeline) error {
+	readerID := pline.ReaderID()
+
+	d.mu.Lock()
+	d.pipelines[readerID] = pline
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.pipelines, readerID)
+		d.mu.Unlock()
+	}()
+
+	return errors.Trace(pline.ProcessPipeline(ctx))
+}
+
 // DockerParams contains parameters for NewDocker.
 type DockerParams struct {
-	types.ReaderParams                   // ReaderParams contains common reader params.
-	Client             *client.Client    // Client is the docker client to use.
-	Persister          types.Persister   // Persister to load/save container state.
-	NewProcessor       processor.Factory // NewProcessor creates a Processor for all messages.
+	types.ReaderParams                    // ReaderParams contains common reader params.
+	Client             *client.Client     // Client is the docker client to use.
+	Persister          types.Persister    // Persister to load/save container state.
+	NewProcessor       processor.Factory  // NewProcessor creates a Processor for all messages.
+	Checkpoint         watcher.Checkpoint // Checkpoint configures persisting of container state.
+	// Buffer configures buffering of container pipelines.
+	Buffer pipeline.Buffer
+	// Time configures the time of container pipelines.
+	Time pipeline.Time
+	// Retention configures pruning of state of removed or stale containers.
+	// Only used when Persister implements types.StateStore.
+	Retention persister.Retention
+	// ShutdownGrace is the time the container pipelines are given to drain
+	// after the context is done.
+	ShutdownGrace time.Duration
+	// Metrics to record for container pipelines, optional.
+	Metrics *metrics.Metrics
+	// InitialState is used by the containers without a persisted state.
+	// Only the Timestamp is used, since cursors are container specific.
+	InitialState types.State
+	// Restart configures the backoff of restarting failed container
+	// pipelines while following the logs. The Logger is set by NewDocker.
+	Restart supervisor.Params
+	// ProbeInterval is the time between the pings of the docker daemon,
+	// which report progress while no events are received. Defaults to
+	// DefaultDockerProbeInterval.
+	ProbeInterval time.Duration
 }
 
 // formatDockerSince formats a ts for the ContainerLogs and Events Since
@@ -59,8 +156,180 @@ func (d *Docker) ReaderID() types.ReaderID {
 	return d.params.ReaderID
 }
 
-// ReadLogs implements Reader.
+// containerPrefix returns the prefix of reader IDs of containers.
+func (d *Docker) containerPrefix() string {
+	return string(d.params.ReaderID) + ":"
+}
+
+// prune deletes the state of containers that are not being watched and
+// either no longer exist or have not been updated in Retention.MaxAge.
+func (d *Docker) prune(ctx context.Context, watching func(containerID string) bool) error {
+	store, ok := d.params.Persister.(types.StateStore)
+	if !ok {
+		return nil
+	}
+
+	containers, err := d.params.Client.ContainerList(ctx, dtypes.ContainerListOptions{
+		All: true,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	existing := make(map[string]struct{}, len(containers))
+
+	for _, container := range containers {
+		existing[container.ID] = struct{}{}
+	}
+
+	prefix := d.containerPrefix()
+
+	containerID := func(readerID types.ReaderID) string {
+		return strings.TrimPrefix(string(readerID), prefix)
+	}
+
+	deleted, err := persister.Prune(ctx, persister.PruneParams{
+		Store:  store,
+		Prefix: prefix,
+		MaxAge: d.params.Retention.MaxAge,
+		Now:    time.Now(),
+		Active: func(readerID types.ReaderID) bool {
+			return watching(containerID(readerID))
+		},
+		Exists: func(readerID types.ReaderID) bool {
+			_, ok := existing[containerID(readerID)]
+
+			return ok
+		},
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, readerID := range deleted {
+		if err := d.params.Persister.SaveData(ctx, pipeline.SnapshotKey(readerID), nil); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if len(deleted) > 0 {
+		d.params.Logger.Info("Pruned container states", log.Ctx{
+			"count": len(deleted),
+		})
+	}
+
+	return nil
+}
+
+// containerReaderID returns the reader ID of the container.
+func (d *Docker) containerReaderID(containerID string) types.ReaderID {
+	return types.ReaderID(d.containerPrefix() + containerID)
+}
+
+// newContainer creates the reader of a single container.
+func (d *Docker) newContainer(containerID string) *DockerContainer {
+	readerParams := d.params.ReaderParams
+	readerParams.ReaderID = d.containerReaderID(containerID)
+
+	return NewDockerContainer(DockerContainerParams{
+		ReaderParams: readerParams,
+		Client:       d.params.Client,
+		ContainerID:  containerID,
+	})
+}
+
+// newContainerPipeline creates the pipeline that processes the logs of the
+// container, starting from initialState when there is no persisted state.
+func (d *Docker) newContainerPipeline(
+	logger log.Logger,
+	dc *DockerContainer,
+	initialState types.State,
+	until time.Time,
+) *pipeline.Pipeline {
+	dw := watcher.New(watcher.Params{
+		Persister:     d.params.Persister,
+		Reader:        dc,
+		Logger:        logger,
+		InitialState:  initialState,
+		Checkpoint:    d.params.Checkpoint,
+		Clock:         d.params.Time.Clock,
+		ShutdownGrace: d.params.ShutdownGrace,
+		Metrics:       d.params.Metrics,
+		Until:         until,
+	})
+
+	return pipeline.New(pipeline.Params{
+		Logger:        logger,
+		Watcher:       dw,
+		NewProcessor:  d.params.NewProcessor,
+		Buffer:        d.params.Buffer,
+		Time:          d.params.Time,
+		Persister:     d.params.Persister,
+		ReaderID:      dc.ReaderID(),
+		ShutdownGrace: d.params.ShutdownGrace,
+		Metrics:       d.params.Metrics,
+	})
+}
+
+// readHistory processes the logs of all containers, including the stopped
+// ones, between the params.State timestamp and params.Until, and returns once
+// all of them have been processed. Containers that were removed in the
+// meantime cannot be read.
+func (d *Docker) readHistory(ctx context.Context, params types.ReadLogsParams) error {
+	containers, err := d.params.Client.ContainerList(ctx, dtypes.ContainerListOptions{
+		All: true,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	initialState := types.State{
+		Timestamp: params.State.Timestamp,
+	}
+
+	errCh := make(chan error, len(containers))
+	started := 0
+
+	for _, container := range containers {
+		if time.Unix(container.Created, 0).After(params.Until) {
+			continue
+		}
+
+		logger := d.params.Logger.WithCtx(log.Ctx{
+			"container_id": container.ID,
+		})
+
+		pline := d.newContainerPipeline(logger, d.newContainer(container.ID), initialState, params.Until)
+
+		started++
+
+		readerID := d.containerReaderID(container.ID)
+
+		go func() {
+			defer d.params.Metrics.RemoveReader(readerID)
+
+			errCh <- errors.Trace(d.processContainer(ctx, pline))
+		}()
+	}
+
+	var retErr error
+
+	for i := 0; i < started; i++ {
+		if err := <-errCh; err != nil && retErr == nil {
+			retErr = errors.Trace(err)
+		}
+	}
+
+	return retErr
+}
+
+// ReadLogs implements Reader. When params.Until is set, the logs of the
+// containers up to Until are processed instead of following the events.
 func (d *Docker) ReadLogs(ctx context.Context, params types.ReadLogsParams) error {
+	if !params.Until.IsZero() {
+		return errors.Trace(d.readHistory(ctx, params))
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -106,22 +375,11 @@ func (d *Docker) ReadLogs(ctx context.Context, params types.ReadLogsParams) erro
 			return
 		}
 
-		dcDaemonID := d.params.ReaderID + types.ReaderID(":"+containerID)
-
-		watcherParams := d.params.ReaderParams
-		watcherParams.ReaderID = dcDaemonID
-
-		dockerContainerParams := DockerContainerParams{
-			ReaderParams: watcherParams,
-			Client:       d.params.Client,
-			ContainerID:  containerID,
-		}
-
 		logger := d.params.Logger.WithCtx(log.Ctx{
 			"container_id": containerID,
 		})
 
-		dc := NewDockerContainer(dockerContainerParams)
+		dc := d.newContainer(containerID)
 
 		done := make(chan struct{})
 
@@ -137,6 +395,7 @@ func (d *Docker) ReadLogs(ctx context.Context, params types.ReadLogsParams) erro
 		go func() {
 			defer wg.Done()
 			defer close(done)
+			defer d.params.Metrics.RemoveReader(dc.ReaderID())
 
 			defer func() {
 				select {
@@ -157,29 +416,21 @@ func (d *Docker) ReadLogs(ctx context.Context, params types.ReadLogsParams) erro
 				}
 			}
 
-			watcherParams := watcher.Params{
-				Persister:    d.params.Persister,
-				Reader:       dc,
-				Logger:       logger,
-				InitialState: types.State{}, // TODO make this configurable.
+			initialState := types.State{
+				Timestamp: d.params.InitialState.Timestamp,
 			}
 
-			dw := watcher.New(watcherParams)
+			pline := d.newContainerPipeline(logger, dc, initialState, time.Time{})
 
-			pline := pipeline.New(pipeline.Params{
-				Logger:       logger,
-				Watcher:      dw,
-				NewProcessor: d.params.NewProcessor,
-				BufferSize:   0,
-			})
-
-			if err := pline.ProcessPipeline(ctx); err != nil {
-				if !types.IsError(err, context.Canceled) {
-					logger.Error("Watch failed", err, nil)
-					return
-				}
+			// The failed pipelines are restarted like the supervised readers.
+			runner := containerRunner{
+				docker:   d,
+				pipeline: pline,
 			}
 
+			// Restart only fails once ctx is done.
+			_ = supervisor.Restart(ctx, d.params.Restart, runner)
+
 			logger.Info("Watch done", nil)
 		}()
 	}
@@ -192,6 +443,26 @@ func (d *Docker) ReadLogs(ctx context.Context, params types.ReadLogsParams) erro
 		watchContainer(container.ID)
 	}
 
+	watching := func(containerID string) bool {
+		_, ok := dockerContainers[containerID]
+
+		return ok
+	}
+
+	prune := func() {
+		if err := d.prune(ctx, watching); err != nil {
+			d.params.Logger.Error("Failed to prune container states", err, nil)
+		}
+	}
+
+	prune()
+
+	pruneTicker := time.NewTicker(d.params.Retention.Interval)
+	defer pruneTicker.Stop()
+
+	probeTicker := time.NewTicker(d.params.ProbeInterval)
+	defer probeTicker.Stop()
+
 	readerID := d.params.ReaderID
 
 	for {
@@ -228,6 +499,18 @@ func (d *Docker) ReadLogs(ctx context.Context, params types.ReadLogsParams) erro
 			}
 		case containerID := <-containerDoneCh:
 			removeContainer(containerID)
+		case <-pruneTicker.C:
+			prune()
+		case <-probeTicker.C:
+			// The events stream does not tell whether the daemon is still
+			// responding while there are no events.
+			if _, err := d.params.Client.Ping(ctx); err != nil {
+				d.params.Logger.Error("Failed to ping docker daemon", err, nil)
+
+				continue
+			}
+
+			params.ReportProgress()
 		case err := <-errCh:
 			return errors.Trace(err)
 		case <-ctx.Done():
@@ -69,10 +69,11 @@ func (d *DockerContainer) ReadLogs(ctx context.Context, params types.ReadLogsPar
 
 	reader, err := d.params.Client.ContainerLogs(ctx, containerID, dtypes.ContainerLogsOptions{
 		Since:      formatDockerSince(state.Timestamp),
+		Until:      formatDockerSince(params.Until),
 		ShowStdout: true,
 		ShowStderr: true,
 		Timestamps: true,
-		Follow:     true,
+		Follow:     params.Until.IsZero(),
 	})
 	if err != nil {
 		return errors.Trace(err)
@@ -84,6 +84,9 @@ func (d *Journald) ReadLogs(ctx context.Context, params types.ReadLogsParams) er
 
 			waitResult := journal.Wait(time.Second)
 
+			// Wait returns at least every second, so the reader is not stuck.
+			params.ReportProgress()
+
 			switch waitResult {
 			case sdjournal.SD_JOURNAL_NOP: // No change.
 				continue
@@ -106,6 +109,11 @@ func (d *Journald) ReadLogs(ctx context.Context, params types.ReadLogsParams) er
 		}
 
 		if c == 0 {
+			if !params.Until.IsZero() {
+				// All messages have been read.
+				return nil
+			}
+
 			if err := waitForChange(ctx); err != nil {
 				return errors.Trace(err)
 			}
@@ -118,8 +126,14 @@ func (d *Journald) ReadLogs(ctx context.Context, params types.ReadLogsParams) er
 			return errors.Trace(err)
 		}
 
+		timestamp := time.UnixMicro(int64(entry.RealtimeTimestamp)).UTC()
+
+		if !params.Until.IsZero() && timestamp.After(params.Until) {
+			return nil
+		}
+
 		message := types.Message{
-			Timestamp: time.UnixMicro(int64(entry.RealtimeTimestamp)).UTC(),
+			Timestamp: timestamp,
 			Cursor:    entry.Cursor,
 			Fields:    entry.Fields,
 			ReaderID:  d.params.ReaderID,
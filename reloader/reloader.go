@@ -0,0 +1,199 @@
+package reloader
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/metrics"
+	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/supervisor"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// Reloader applies config changes to the pipelines run by a
+// supervisor.Supervisor. The pipelines of added readers are started, the
+// ones of removed readers are stopped, and the ones of changed readers are
+// restarted from their persisted state. When only the processors or actions
+// of a reader change, the processor is swapped in place.
+type Reloader struct {
+	params Params
+
+	mu      sync.Mutex
+	cfg     *config.Config
+	readers map[types.ReaderID]*reader
+	shared  *factory.Shared // shared instances are kept across reloads.
+}
+
+// Params contains parameters for New.
+type Params struct {
+	Logger     log.Logger             // Logger to log the reloads with.
+	Supervisor *supervisor.Supervisor // Supervisor to run the pipelines with.
+	Persister  types.Persister        // Persister shared by all pipelines.
+	Metrics    *metrics.Metrics       // Metrics to record, optional.
+}
+
+// reader is a reader that is currently configured.
+type reader struct {
+	pipeline    *pipeline.Pipeline
+	fingerprint factory.Fingerprint
+}
+
+// Result describes the changes made by Reload.
+type Result struct {
+	Added     []types.ReaderID // Added readers were started.
+	Removed   []types.ReaderID // Removed readers were stopped.
+	Restarted []types.ReaderID // Restarted readers had their pipelines replaced.
+	Swapped   []types.ReaderID // Swapped readers had their processors replaced.
+}
+
+// New creates a new instance of Reloader.
+func New(params Params) *Reloader {
+	params.Logger = params.Logger.WithNamespaceAppended("reloader")
+
+	return &Reloader{
+		params:  params,
+		readers: map[types.ReaderID]*reader{},
+		shared:  factory.NewShared(),
+	}
+}
+
+// Reload applies cfg. The first call adds the pipelines of all readers.
+// When cfg is invalid, an error is returned and the current configuration
+// keeps running.
+func (r *Reloader) Reload(cfg *config.Config) (Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result Result
+
+	if r.cfg != nil {
+		if !samePersister(r.cfg.Persister, cfg.Persister) {
+			return result, errors.Errorf("persister changes require a restart")
+		}
+
+		if cfg.Supervisor != r.cfg.Supervisor {
+			r.params.Logger.Warn("Supervisor changes require a restart, ignoring", nil)
+		}
+
+		if cfg.HTTP != r.cfg.HTTP {
+			r.params.Logger.Warn("HTTP changes require a restart, ignoring", nil)
+		}
+
+		if cfg.Health != r.cfg.Health {
+			r.params.Logger.Warn("Health changes require a restart, ignoring", nil)
+		}
+	}
+
+	fingerprints, err := factory.NewFingerprints(cfg)
+	if err != nil {
+		return result, errors.Trace(err)
+	}
+
+	// Only the pipelines of the changed readers are created, the others keep
+	// running as they are.
+	changed := make(map[types.ReaderID]struct{}, len(fingerprints))
+
+	for readerID, fingerprint := range fingerprints {
+		if current, ok := r.readers[readerID]; !ok || current.fingerprint != fingerprint {
+			changed[readerID] = struct{}{}
+		}
+	}
+
+	pipelines, err := factory.NewPipelines(
+		r.params.Logger, cfg, r.params.Persister, r.params.Metrics, r.shared, changed)
+	if err != nil {
+		return result, errors.Annotate(err, "invalid config")
+	}
+
+	sup := r.params.Supervisor
+
+	for _, readerID := range r.readerIDs() {
+		if _, ok := fingerprints[readerID]; ok {
+			continue
+		}
+
+		if err := sup.Remove(readerID); err != nil {
+			r.params.Logger.Error("Failed to remove reader", err, nil)
+		}
+
+		delete(r.readers, readerID)
+
+		result.Removed = append(result.Removed, readerID)
+	}
+
+	for _, pline := range pipelines {
+		readerID := pline.ReaderID()
+		fingerprint := fingerprints[readerID]
+
+		current, ok := r.readers[readerID]
+
+		switch {
+		case !ok:
+			sup.Add(pline)
+
+			r.readers[readerID] = &reader{
+				pipeline:    pline,
+				fingerprint: fingerprint,
+			}
+
+			result.Added = append(result.Added, readerID)
+		case current.fingerprint.Reader != fingerprint.Reader:
+			if err := sup.Replace(pline); err != nil {
+				return result, errors.Trace(err)
+			}
+
+			r.readers[readerID] = &reader{
+				pipeline:    pline,
+				fingerprint: fingerprint,
+			}
+
+			result.Restarted = append(result.Restarted, readerID)
+		case current.fingerprint.Processors != fingerprint.Processors:
+			current.pipeline.SetProcessorFactory(pline.ProcessorFactory())
+			current.fingerprint = fingerprint
+
+			result.Swapped = append(result.Swapped, readerID)
+		}
+	}
+
+	r.cfg = cfg
+	r.shared.Commit()
+
+	r.params.Logger.Info("Config loaded", log.Ctx{
+		"added":     len(result.Added),
+		"removed":   len(result.Removed),
+		"restarted": len(result.Restarted),
+		"swapped":   len(result.Swapped),
+	})
+
+	return result, nil
+}
+
+// readerIDs returns the IDs of the configured readers, sorted.
+func (r *Reloader) readerIDs() []types.ReaderID {
+	ret := make([]types.ReaderID, 0, len(r.readers))
+
+	for readerID := range r.readers {
+		ret = append(ret, readerID)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+
+	return ret
+}
+
+// samePersister returns true when both configs use the same storage.
+// Checkpoint and Retention can change since they are per pipeline.
+func samePersister(a, b config.Persister) bool {
+	a.Checkpoint, b.Checkpoint = config.Checkpoint{}, config.Checkpoint{}
+	a.Retention, b.Retention = config.Retention{}, config.Retention{}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,160 @@
+package reloader_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/reloader"
+	"github.com/jeremija/taily/supervisor"
+	"github.com/jeremija/taily/types"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseConfig = `
+actions:
+  log:
+    type: log
+    log:
+      format:
+        type: plain
+processors:
+  errors:
+    type: matcher
+    action: log
+    matcher:
+      start_line:
+        type: substring
+        substring: error
+readers:
+  - id: a
+    type: journald
+    processors:
+      - errors
+  - id: b
+    type: journald
+    processors:
+      - errors
+persister:
+  type: noop
+`
+
+func TestReloader(t *testing.T) {
+	sup := supervisor.New(supervisor.Params{
+		Logger: log.New(),
+	})
+
+	r := reloader.New(reloader.Params{
+		Logger:     log.New(),
+		Supervisor: sup,
+		Persister:  persister.NewNoop(),
+	})
+
+	load := func(t *testing.T, str string) *config.Config {
+		var cfg config.Config
+
+		require.NoError(t, cfg.FromYAMLString(str))
+
+		return &cfg
+	}
+
+	readerIDs := func() []types.ReaderID {
+		var ret []types.ReaderID
+
+		for _, status := range sup.Status() {
+			ret = append(ret, status.ReaderID)
+		}
+
+		return ret
+	}
+
+	result, err := r.Reload(load(t, baseConfig))
+	require.NoError(t, err)
+	assert.Equal(t, reloader.Result{Added: []types.ReaderID{"a", "b"}}, result)
+	assert.Equal(t, []types.ReaderID{"a", "b"}, readerIDs())
+
+	testCases := []struct {
+		name string
+		// replace contains old and new pairs applied to the config of the
+		// previous test case.
+		replace []string
+		wantErr string
+		want    reloader.Result
+	}{
+		{
+			name: "unchanged",
+		},
+		{
+			name:    "processor changed",
+			replace: []string{"substring: error", "substring: fail"},
+			want:    reloader.Result{Swapped: []types.ReaderID{"a", "b"}},
+		},
+		{
+			name: "reader changed",
+			replace: []string{"  - id: b\n    type: journald\n", `  - id: b
+    type: journald
+    buffer:
+      size: 10
+`},
+			want: reloader.Result{Restarted: []types.ReaderID{"b"}},
+		},
+		{
+			name:    "reader added and removed",
+			replace: []string{"id: b", "id: c"},
+			want: reloader.Result{
+				Added:   []types.ReaderID{"c"},
+				Removed: []types.ReaderID{"b"},
+			},
+		},
+		{
+			name:    "invalid",
+			replace: []string{"      - errors\n", "      - missing\n"},
+			wantErr: "invalid config",
+		},
+		{
+			name:    "persister changed",
+			replace: []string{"type: noop", "type: bolt"},
+			wantErr: "persister changes require a restart",
+		},
+	}
+
+	str := baseConfig
+
+	for _, tc := range testCases {
+		tc := tc
+
+		next := str
+
+		for i := 0; i < len(tc.replace); i += 2 {
+			require.Contains(t, next, tc.replace[i], tc.name)
+
+			next = strings.Replace(next, tc.replace[i], tc.replace[i+1], 1)
+		}
+
+		t.Run(tc.name, func(t *testing.T) {
+			before := readerIDs()
+
+			result, err := r.Reload(load(t, next))
+
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Equal(t, before, readerIDs(), "readers should not change")
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, result)
+		})
+
+		if tc.wantErr == "" {
+			str = next
+		}
+	}
+
+	assert.Equal(t, []types.ReaderID{"a", "c"}, readerIDs())
+}
@@ -0,0 +1,288 @@
+package ruletest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/factory"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/pipeline"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFlushAfter is the default Params.FlushAfter.
+const DefaultFlushAfter = 24 * time.Hour
+
+// Expectations describes the actions expected to be performed.
+type Expectations struct {
+	// Reader is the ID of the reader whose processors are tested. Optional
+	// when the config has a single reader.
+	Reader types.ReaderID `yaml:"reader"`
+	// Actions contains the expected calls of each action. Actions that are
+	// not listed are not checked, while an empty list means that the action
+	// is expected not to be performed.
+	Actions map[string][]Call `yaml:"actions"`
+}
+
+// Call describes a single action call by the texts of its messages.
+type Call struct {
+	Messages []string `yaml:"messages"`
+}
+
+// Result contains the calls of every action that was performed.
+type Result map[string][]Call
+
+// Params contains parameters for Run.
+type Params struct {
+	Logger   log.Logger
+	Config   *config.Config
+	ReaderID types.ReaderID  // ReaderID of the reader whose processors are run.
+	Messages []types.Message // Messages to process, ordered by time.
+	// FlushAfter is the time after the last message at which the processors
+	// receive the final tick, so that all time windows expire. Defaults to
+	// DefaultFlushAfter.
+	FlushAfter time.Duration
+}
+
+// ReadExpectations decodes the YAML expectations from reader.
+func ReadExpectations(reader io.Reader) (Expectations, error) {
+	var e Expectations
+
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&e); err != nil && !types.IsError(err, io.EOF) {
+		return e, errors.Annotate(err, "decode expectations")
+	}
+
+	return e, nil
+}
+
+// ReadMessages reads the fixture messages from reader, one per line. A line
+// is either a message in the JSON format of the json formatter, or plain text
+// which is used as the message text. Plain lines and JSON messages without a
+// timestamp take the timestamp of the previous message, or start for the
+// first one.
+func ReadMessages(reader io.Reader, readerID types.ReaderID, start time.Time) ([]types.Message, error) {
+	var ret []types.Message
+
+	ts := start
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+
+		message := types.NewMessage(ts, readerID, string(line), nil)
+
+		if bytes.HasPrefix(line, []byte("{")) {
+			message = types.Message{}
+
+			if err := json.Unmarshal(line, &message); err != nil {
+				return nil, errors.Annotatef(err, "line %d", lineNum)
+			}
+
+			if message.Timestamp.IsZero() {
+				message.Timestamp = ts
+			}
+
+			if message.ReaderID == "" {
+				message.ReaderID = readerID
+			}
+		}
+
+		ts = message.Timestamp
+
+		ret = append(ret, message)
+	}
+
+	return ret, errors.Trace(scanner.Err())
+}
+
+// Run processes the messages with the processors of the reader, with all
+// actions replaced by recorders, and returns the recorded calls.
+//
+// The processors receive ticks with the time derived from the message
+// timestamps, like in the event time mode of the pipeline. After the last
+// message, a final tick at FlushAfter is sent to flush the pending groups.
+func Run(ctx context.Context, params Params) (Result, error) {
+	if params.FlushAfter <= 0 {
+		params.FlushAfter = DefaultFlushAfter
+	}
+
+	cfg := params.Config
+
+	readerConfig, err := cfg.FindReader(params.ReaderID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	recorders := make(map[string]*recorder, len(cfg.Actions))
+	actionsMap := make(map[string]types.Action, len(cfg.Actions))
+
+	for name := range cfg.Actions {
+		r := &recorder{}
+
+		recorders[name] = r
+		actionsMap[name] = r
+	}
+
+	// The processors start without state, so the cluster templates would
+	// otherwise only be learned.
+	processorsMap, err := factory.NewProcessorsMap(
+		params.Logger, factory.NoWarmup(cfg.Processors), actionsMap, persister.NewNoop(), nil, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	newProcessor, err := factory.NewProcessorsFromMap(
+		params.Logger, processorsMap, readerConfig.Processors, readerConfig.Composition)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	proc, err := newProcessor()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	eventTime := pipeline.NewEventTime(readerConfig.Time.TickInterval)
+
+	for _, message := range params.Messages {
+		// The fixture is processed instantly, so the message timestamp is
+		// also used as its arrival time.
+		if ts := eventTime.Message(message.Timestamp, message.Timestamp); !ts.IsZero() {
+			if err := proc.Tick(ctx, ts); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+
+		if err := proc.ProcessMessage(ctx, message); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	if n := len(params.Messages); n > 0 {
+		flush := params.Messages[n-1].Timestamp.Add(params.FlushAfter)
+
+		if err := proc.Tick(ctx, flush); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	// Wait for the in-flight actions.
+	if closer, ok := proc.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	result := Result{}
+
+	for name, r := range recorders {
+		if calls := r.result(); len(calls) > 0 {
+			result[name] = calls
+		}
+	}
+
+	return result, nil
+}
+
+// Check compares the result with the expected calls, and returns the
+// mismatches. The calls of each action are compared in order. Expected
+// actions that are not configured in cfg are reported too, so that a
+// misspelled action cannot pass.
+func Check(cfg *config.Config, expectations Expectations, result Result) []string {
+	names := make([]string, 0, len(expectations.Actions))
+
+	for name := range expectations.Actions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var ret []string
+
+	for _, name := range names {
+		if _, ok := cfg.Actions[name]; !ok {
+			ret = append(ret, fmt.Sprintf("%s: action not configured", name))
+
+			continue
+		}
+
+		want := expectations.Actions[name]
+		got := result[name]
+
+		if len(want) != len(got) {
+			ret = append(ret, fmt.Sprintf("%s: expected %d calls, got %d", name, len(want), len(got)))
+
+			continue
+		}
+
+		for i := range want {
+			if !equalTexts(want[i].Messages, got[i].Messages) {
+				ret = append(ret, fmt.Sprintf("%s: call %d: expected messages %q, got %q",
+					name, i+1, want[i].Messages, got[i].Messages))
+			}
+		}
+	}
+
+	return ret
+}
+
+// equalTexts returns true when both slices contain the same texts.
+func equalTexts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// recorder is a types.Action that records the texts of all calls.
+type recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// PerformAction implements types.Action.
+func (r *recorder) PerformAction(ctx context.Context, messages []types.Message) error {
+	texts := make([]string, len(messages))
+
+	for i := range messages {
+		texts[i] = messages[i].Text()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, Call{Messages: texts})
+
+	return nil
+}
+
+// result returns the recorded calls.
+func (r *recorder) result() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
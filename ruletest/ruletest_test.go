@@ -0,0 +1,161 @@
+package ruletest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/config"
+	"github.com/jeremija/taily/ruletest"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+actions:
+  notify:
+    type: log
+    log:
+      format:
+        type: plain
+  page:
+    type: log
+    log:
+      format:
+        type: plain
+processors:
+  panics:
+    type: matcher
+    action: notify
+    matcher:
+      preset: golang_panic
+  restarts:
+    type: sequence
+    action: page
+    sequence:
+      window: 1m
+      steps:
+        - matcher:
+            type: substring
+            substring: stopping
+        - matcher:
+            type: substring
+            substring: started
+          absent: true
+readers:
+  - id: app
+    type: journald
+    processors:
+      - panics
+      - restarts
+persister:
+  type: noop
+`
+
+const testFixture = `panic: boom
+
+goroutine 1 [running]:
+main.main()
+{"ts":"2000-01-01T00:00:10Z","fields":{"MESSAGE":"done"}}
+{"ts":"2000-01-01T00:01:00Z","fields":{"MESSAGE":"stopping"}}
+`
+
+const testExpectations = `
+actions:
+  notify:
+    - messages:
+        - "panic: boom"
+        - ""
+        - "goroutine 1 [running]:"
+        - "main.main()"
+  page:
+    - messages:
+        - stopping
+`
+
+func TestRun(t *testing.T) {
+	var cfg config.Config
+
+	require.NoError(t, cfg.FromYAMLString(testConfig))
+
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	messages, err := ruletest.ReadMessages(strings.NewReader(testFixture), "app", start)
+	require.NoError(t, err)
+	require.Len(t, messages, 6)
+	assert.Equal(t, start, messages[0].Timestamp)
+	assert.Equal(t, start.Add(time.Minute), messages[5].Timestamp)
+
+	result, err := ruletest.Run(context.Background(), ruletest.Params{
+		Logger:   log.New(),
+		Config:   &cfg,
+		Messages: messages,
+	})
+	require.NoError(t, err)
+
+	expectations, err := ruletest.ReadExpectations(strings.NewReader(testExpectations))
+	require.NoError(t, err)
+
+	assert.Empty(t, ruletest.Check(&cfg, expectations, result))
+
+	expectations.Actions["page"] = nil
+	expectations.Actions["notify"][0].Messages[0] = "panic: other"
+	expectations.Actions["pgae"] = nil
+
+	assert.Equal(t, []string{
+		`notify: call 1: expected messages ["panic: other" "" "goroutine 1 [running]:" "main.main()"], ` +
+			`got ["panic: boom" "" "goroutine 1 [running]:" "main.main()"]`,
+		`page: expected 0 calls, got 1`,
+		`pgae: action not configured`,
+	}, ruletest.Check(&cfg, expectations, result))
+}
+
+func TestRun_clusterWarmup(t *testing.T) {
+	var cfg config.Config
+
+	require.NoError(t, cfg.FromYAMLString(`
+actions:
+  notify:
+    type: log
+    log:
+      format:
+        type: plain
+processors:
+  new_errors:
+    type: cluster
+    action: notify
+readers:
+  - id: app
+    type: journald
+    processors:
+      - new_errors
+persister:
+  type: noop
+`))
+
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	messages, err := ruletest.ReadMessages(strings.NewReader("error: disk full\n"), "app", start)
+	require.NoError(t, err)
+
+	result, err := ruletest.Run(context.Background(), ruletest.Params{
+		Logger:   log.New(),
+		Config:   &cfg,
+		Messages: messages,
+	})
+	require.NoError(t, err)
+
+	// There is no warmup without persisted templates, so the first template
+	// is reported.
+	expectations, err := ruletest.ReadExpectations(strings.NewReader(`
+actions:
+  notify:
+    - messages:
+        - "error: disk full"
+`))
+	require.NoError(t, err)
+
+	assert.Empty(t, ruletest.Check(&cfg, expectations, result))
+}
@@ -0,0 +1,449 @@
+package supervisor
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+)
+
+// Defaults for Params.
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 5 * time.Minute
+	DefaultResetAfter = time.Minute
+)
+
+// Runner is a component that can be supervised, for example
+// pipeline.Pipeline.
+type Runner interface {
+	// ReaderID returns the ID of the reader being run.
+	ReaderID() types.ReaderID
+	// ProcessPipeline runs until ctx is done or an error occurs. It must be
+	// safe to call again after it returns, and it must continue from the
+	// persisted state.
+	ProcessPipeline(ctx context.Context) error
+}
+
+// Heartbeater is implemented by Runners that report their liveness, for
+// example pipeline.Pipeline.
+type Heartbeater interface {
+	// Heartbeat returns the last time the runner was active.
+	Heartbeat() time.Time
+}
+
+// ProgressReporter is implemented by Runners that report the progress of
+// their reader separately from the heartbeat, for example
+// pipeline.Pipeline.
+type ProgressReporter interface {
+	// Progress returns the last time the reader delivered a message or
+	// reported that it is waiting for new ones, or the zero time when
+	// unknown.
+	Progress() time.Time
+}
+
+// Supervisor runs Runners and restarts the ones that fail with a capped
+// exponential backoff. Runners that complete without an error are not
+// restarted. Runners can be added and removed while running.
+type Supervisor struct {
+	params Params
+
+	mu       sync.Mutex
+	ctx      context.Context // ctx is set while Run is running.
+	runners  []*supervised
+	statuses map[types.ReaderID]*Status
+	running  int           // running is the number of started runners.
+	exitCh   chan struct{} // exitCh is signaled when a runner exits.
+}
+
+// supervised is a Runner added to the Supervisor.
+type supervised struct {
+	runner Runner
+	cancel context.CancelFunc // cancel is set once the runner is started.
+	done   chan struct{}      // done is closed once the runner exits.
+}
+
+// Params contains parameters for New.
+type Params struct {
+	Logger     log.Logger    // Logger to log restarts with.
+	MinBackoff time.Duration // MinBackoff is the first restart delay. Defaults to DefaultMinBackoff.
+	MaxBackoff time.Duration // MaxBackoff caps the restart delay. Defaults to DefaultMaxBackoff.
+	// ResetAfter is the duration after which a running Runner is considered
+	// healthy and the backoff is reset. Defaults to DefaultResetAfter.
+	ResetAfter time.Duration
+}
+
+// State describes the state of a supervised Runner.
+type State string
+
+// Values for State.
+const (
+	StateRunning   State = "running"   // StateRunning means the runner is running.
+	StateBackoff   State = "backoff"   // StateBackoff means the runner failed and will be restarted.
+	StateCompleted State = "completed" // StateCompleted means the runner completed without an error.
+	StateStopped   State = "stopped"   // StateStopped means the supervisor was stopped.
+)
+
+// Status describes the status of a supervised Runner.
+type Status struct {
+	ReaderID  types.ReaderID `json:"reader_id"`
+	State     State          `json:"state"`
+	Since     time.Time      `json:"since"`                // Since is the time State was entered.
+	Restarts  int            `json:"restarts"`             // Restarts is the total number of restarts.
+	LastError string         `json:"last_error,omitempty"` // LastError is the last error, if any.
+	// Heartbeat is the last time the runner was active. It is only set for
+	// runners implementing Heartbeater.
+	Heartbeat time.Time `json:"heartbeat"`
+	// Progress is the last time the reader delivered a message or reported
+	// that it is waiting for new ones. It is only set for runners
+	// implementing ProgressReporter.
+	Progress time.Time `json:"progress"`
+	// Children contains the heartbeats of the pipelines run by the reader,
+	// which are not supervised. It is only set for runners implementing
+	// types.ChildHeartbeater.
+	Children map[types.ReaderID]time.Time `json:"children,omitempty"`
+}
+
+// New creates a new instance of Supervisor.
+func New(params Params) *Supervisor {
+	return &Supervisor{
+		params:   params.withDefaults(),
+		statuses: map[types.ReaderID]*Status{},
+		exitCh:   make(chan struct{}, 1),
+	}
+}
+
+// withDefaults returns a copy of params with the defaults set.
+func (params Params) withDefaults() Params {
+	params.Logger = params.Logger.WithNamespaceAppended("supervisor")
+
+	if params.MinBackoff <= 0 {
+		params.MinBackoff = DefaultMinBackoff
+	}
+
+	if params.MaxBackoff <= 0 {
+		params.MaxBackoff = DefaultMaxBackoff
+	}
+
+	if params.MaxBackoff < params.MinBackoff {
+		params.MaxBackoff = params.MinBackoff
+	}
+
+	if params.ResetAfter <= 0 {
+		params.ResetAfter = DefaultResetAfter
+	}
+
+	return params
+}
+
+// Restart runs the runner and restarts it on failure with the same backoff
+// as a Supervisor, until it completes or ctx is done. It is used for runners
+// that are not added to a Supervisor, e.g. the pipelines of docker
+// containers. It returns nil when the runner completes.
+func Restart(ctx context.Context, params Params, runner Runner) error {
+	return errors.Trace(restart(ctx, params.withDefaults(), runner, func(State, error) {}))
+}
+
+// Add adds the runner to be started by Run. When Run is already running, the
+// runner is started immediately. The ReaderID must be unique.
+func (s *Supervisor) Add(runner Runner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sup := &supervised{
+		runner: runner,
+		done:   make(chan struct{}),
+	}
+
+	s.runners = append(s.runners, sup)
+	s.statuses[runner.ReaderID()] = &Status{
+		ReaderID: runner.ReaderID(),
+		State:    StateStopped,
+	}
+
+	if s.ctx != nil {
+		s.start(sup)
+	}
+}
+
+// index returns the index of the runner with readerID, or -1 when there is
+// no such runner. It must be called with mu held.
+func (s *Supervisor) index(readerID types.ReaderID) int {
+	for i, sup := range s.runners {
+		if sup.runner.ReaderID() == readerID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Remove stops the runner with readerID and waits for it to exit. An error is
+// returned when there is no such runner.
+func (s *Supervisor) Remove(readerID types.ReaderID) error {
+	s.mu.Lock()
+
+	i := s.index(readerID)
+	if i < 0 {
+		s.mu.Unlock()
+
+		return errors.NotFoundf("runner %q", readerID)
+	}
+
+	sup := s.runners[i]
+
+	s.runners = append(s.runners[:i], s.runners[i+1:]...)
+	delete(s.statuses, readerID)
+
+	s.mu.Unlock()
+
+	sup.stop()
+
+	return nil
+}
+
+// Replace stops the runner with the same ReaderID, waits for it to exit and
+// starts runner in its place. Unlike Remove followed by Add, Run does not
+// return in the meantime. An error is returned when there is no such runner.
+func (s *Supervisor) Replace(runner Runner) error {
+	readerID := runner.ReaderID()
+
+	s.mu.Lock()
+
+	i := s.index(readerID)
+	if i < 0 {
+		s.mu.Unlock()
+
+		return errors.NotFoundf("runner %q", readerID)
+	}
+
+	old := s.runners[i]
+	sup := &supervised{
+		runner: runner,
+		done:   make(chan struct{}),
+	}
+
+	s.runners[i] = sup
+
+	// Keep Run from returning while the old runner is stopped.
+	s.running++
+
+	s.mu.Unlock()
+
+	old.stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The runner might have been removed or replaced in the meantime.
+	if i := s.index(readerID); i >= 0 && s.runners[i] == sup {
+		s.statuses[readerID] = &Status{
+			ReaderID: readerID,
+			State:    StateStopped,
+		}
+
+		if s.ctx != nil {
+			s.start(sup)
+		}
+	}
+
+	s.exited()
+
+	return nil
+}
+
+// stop stops the runner, if started, and waits for it to exit.
+func (sup *supervised) stop() {
+	if sup.cancel != nil {
+		sup.cancel()
+		<-sup.done
+	}
+}
+
+// Status returns the status of all runners, sorted by ReaderID.
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := make([]Status, 0, len(s.statuses))
+
+	for _, sup := range s.runners {
+		status := *s.statuses[sup.runner.ReaderID()]
+
+		if hb, ok := sup.runner.(Heartbeater); ok {
+			status.Heartbeat = hb.Heartbeat()
+		}
+
+		if pr, ok := sup.runner.(ProgressReporter); ok {
+			status.Progress = pr.Progress()
+		}
+
+		if children, ok := sup.runner.(types.ChildHeartbeater); ok {
+			status.Children = children.ChildHeartbeats()
+		}
+
+		ret = append(ret, status)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ReaderID < ret[j].ReaderID
+	})
+
+	return ret
+}
+
+// setState updates the status of the reader.
+func (s *Supervisor) setState(readerID types.ReaderID, state State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[readerID]
+	if !ok {
+		// The runner has been removed.
+		return
+	}
+
+	if state == StateRunning && status.State == StateBackoff {
+		status.Restarts++
+	}
+
+	status.State = state
+	status.Since = time.Now()
+
+	if err != nil {
+		status.LastError = err.Error()
+	}
+}
+
+// Run runs all runners until they complete or ctx is done. Failed runners
+// are restarted. Run also returns once all runners have been removed.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+
+	s.ctx = ctx
+
+	for _, sup := range s.runners {
+		s.start(sup)
+	}
+
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		running := s.running
+		s.mu.Unlock()
+
+		if running == 0 {
+			break
+		}
+
+		<-s.exitCh
+	}
+
+	s.mu.Lock()
+	s.ctx = nil
+	s.mu.Unlock()
+
+	return errors.Trace(ctx.Err())
+}
+
+// start starts supervising sup. It must be called with mu held.
+func (s *Supervisor) start(sup *supervised) {
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	sup.cancel = cancel
+	s.running++
+
+	go func() {
+		defer func() {
+			cancel()
+			close(sup.done)
+
+			s.mu.Lock()
+			s.exited()
+			s.mu.Unlock()
+		}()
+
+		s.supervise(ctx, sup.runner)
+	}()
+}
+
+// exited decrements the number of running runners and notifies Run. It must
+// be called with mu held.
+func (s *Supervisor) exited() {
+	s.running--
+
+	select {
+	case s.exitCh <- struct{}{}:
+	default:
+	}
+}
+
+// supervise runs the runner and restarts it on failure until ctx is done.
+func (s *Supervisor) supervise(ctx context.Context, runner Runner) {
+	readerID := runner.ReaderID()
+
+	_ = restart(ctx, s.params, runner, func(state State, err error) {
+		s.setState(readerID, state, err)
+	})
+}
+
+// restart runs the runner and restarts it on failure until it completes or
+// ctx is done, reporting the state changes to setState. It returns nil when
+// the runner completes, or the error of ctx.
+func restart(ctx context.Context, params Params, runner Runner, setState func(State, error)) error {
+	logger := types.LoggerWithReaderID(params.Logger, runner.ReaderID())
+	backoff := params.MinBackoff
+
+	for {
+		setState(StateRunning, nil)
+
+		start := time.Now()
+
+		err := runner.ProcessPipeline(ctx)
+
+		if ctx.Err() != nil {
+			setState(StateStopped, nil)
+
+			return errors.Trace(ctx.Err())
+		}
+
+		if err == nil {
+			logger.Info("Reader completed", nil)
+			setState(StateCompleted, nil)
+
+			return nil
+		}
+
+		if time.Since(start) >= params.ResetAfter {
+			backoff = params.MinBackoff
+		}
+
+		logger.Error("Reader failed, restarting", err, log.Ctx{
+			"backoff": backoff.String(),
+		})
+
+		setState(StateBackoff, err)
+
+		timer := time.NewTimer(backoff)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			setState(StateStopped, nil)
+
+			return errors.Trace(ctx.Err())
+		}
+
+		backoff *= 2
+
+		if backoff > params.MaxBackoff {
+			backoff = params.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package supervisor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/supervisor"
+	"github.com/jeremija/taily/types"
+	"github.com/juju/errors"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type runner struct {
+	readerID types.ReaderID
+	errs     []error
+	calls    int
+}
+
+func (r *runner) ReaderID() types.ReaderID {
+	return r.readerID
+}
+
+func (r *runner) ProcessPipeline(ctx context.Context) error {
+	r.calls++
+
+	if len(r.errs) == 0 {
+		<-ctx.Done()
+
+		return errors.Trace(ctx.Err())
+	}
+
+	err := r.errs[0]
+	r.errs = r.errs[1:]
+
+	return err
+}
+
+func TestSupervisor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := supervisor.New(supervisor.Params{
+		Logger:     log.New(),
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	})
+
+	completing := &runner{
+		readerID: "a",
+		errs:     []error{errors.Errorf("failed 1"), errors.Errorf("failed 2"), nil},
+	}
+
+	running := &runner{
+		readerID: "b",
+		errs:     []error{errors.Errorf("failed")},
+	}
+
+	s.Add(completing)
+	s.Add(running)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- s.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		status := s.Status()
+
+		return status[0].State == supervisor.StateCompleted &&
+			status[1].State == supervisor.StateRunning && status[1].Restarts == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+
+	err := <-errCh
+	assert.True(t, types.IsError(err, context.Canceled))
+
+	status := s.Status()
+	require.Len(t, status, 2)
+
+	assert.Equal(t, types.ReaderID("a"), status[0].ReaderID)
+	assert.Equal(t, supervisor.StateCompleted, status[0].State)
+	assert.Equal(t, 2, status[0].Restarts)
+	assert.Equal(t, "failed 2", status[0].LastError)
+	assert.Equal(t, 3, completing.calls)
+
+	assert.Equal(t, supervisor.StateStopped, status[1].State)
+	assert.Equal(t, 1, status[1].Restarts)
+	assert.Equal(t, 2, running.calls)
+}
+
+func TestSupervisor_AddRemove(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := supervisor.New(supervisor.Params{
+		Logger: log.New(),
+	})
+
+	a := &runner{readerID: "a"}
+	b := &runner{readerID: "b"}
+
+	s.Add(a)
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- s.Run(ctx)
+	}()
+
+	s.Add(b)
+
+	assert.Eventually(t, func() bool {
+		status := s.Status()
+
+		return len(status) == 2 &&
+			status[0].State == supervisor.StateRunning &&
+			status[1].State == supervisor.StateRunning
+	}, time.Second, time.Millisecond)
+
+	a2 := &runner{readerID: "a"}
+
+	require.NoError(t, s.Replace(a2))
+	assert.Equal(t, 1, a.calls)
+
+	assert.Eventually(t, func() bool {
+		status := s.Status()
+
+		return len(status) == 2 && status[0].State == supervisor.StateRunning
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, s.Remove("a"))
+	assert.Equal(t, 1, a2.calls)
+
+	assert.True(t, errors.IsNotFound(s.Remove("a")))
+	assert.True(t, errors.IsNotFound(s.Replace(a)))
+
+	status := s.Status()
+	require.Len(t, status, 1)
+	assert.Equal(t, types.ReaderID("b"), status[0].ReaderID)
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("run returned while a runner is running: %+v", err)
+	default:
+	}
+
+	require.NoError(t, s.Remove("b"))
+
+	require.NoError(t, <-errCh, "run should complete when all runners are removed")
+}
+
+func TestRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	params := supervisor.Params{
+		Logger:     log.New(),
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	}
+
+	completing := &runner{
+		readerID: "a",
+		errs:     []error{errors.Errorf("failed 1"), errors.Errorf("failed 2"), nil},
+	}
+
+	require.NoError(t, supervisor.Restart(ctx, params, completing))
+	assert.Equal(t, 3, completing.calls)
+
+	running := &runner{
+		readerID: "b",
+		errs:     []error{errors.Errorf("failed")},
+	}
+
+	ctx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	err := supervisor.Restart(ctx, params, running)
+	assert.True(t, types.IsError(err, context.DeadlineExceeded), "expected deadline exceeded, but got: %+v", err)
+	assert.Equal(t, 2, running.calls)
+}
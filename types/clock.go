@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+// Clock is a source of time. It can be mocked to make time-based processing
+// deterministic in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a new Ticker that ticks every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+	// Reset stops the ticker and resets its period to d, so that the next
+	// tick arrives after d.
+	Reset(d time.Duration)
+}
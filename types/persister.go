@@ -1,6 +1,9 @@
 package types
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Persister is a component for loading and reading reader state.
 type Persister interface {
@@ -9,4 +12,25 @@ type Persister interface {
 	LoadState(context.Context, ReaderID) (State, error)
 	// SaveSave saves the reader state.
 	SaveState(context.Context, ReaderID, State) error
+	// LoadData loads arbitrary data stored under key, for example processor
+	// state. When the data does not exist, it must return nil and no error.
+	LoadData(ctx context.Context, key string) ([]byte, error)
+	// SaveData stores arbitrary data under key. Saving empty data deletes it.
+	SaveData(ctx context.Context, key string, data []byte) error
+}
+
+// StateInfo describes a reader state stored by StateStore.
+type StateInfo struct {
+	ReaderID ReaderID  // ReaderID the state belongs to.
+	Updated  time.Time // Updated is the time the state was last saved.
+}
+
+// StateStore is an optional interface implemented by Persisters that can
+// enumerate and delete reader states, so that stale states can be pruned.
+type StateStore interface {
+	// ListStates returns all stored reader states.
+	ListStates(context.Context) ([]StateInfo, error)
+	// DeleteState deletes the reader state. Deleting a missing state must not
+	// return an error.
+	DeleteState(context.Context, ReaderID) error
 }
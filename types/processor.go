@@ -11,3 +11,69 @@ type Processor interface {
 	ProcessMessage(context.Context, Message) error
 	Tick(context.Context, time.Time) error
 }
+
+// Snapshotter is implemented by processors that keep in-flight state, for
+// example open multiline matches, which should survive restarts.
+type Snapshotter interface {
+	// Snapshot serializes the current state. It may return nil when there is
+	// nothing to persist.
+	Snapshot() ([]byte, error)
+	// Restore restores the state previously returned by Snapshot. It must be
+	// called before any messages are processed.
+	Restore([]byte) error
+}
+
+// Grouper is implemented by processors that keep open groups, for example
+// multiline matches that have not ended yet.
+type Grouper interface {
+	// OpenGroups returns the number of open groups.
+	OpenGroups() int
+}
+
+// NamedGrouper is implemented by processors that report the open groups of
+// the named processors they consist of, see processor.Named.
+type NamedGrouper interface {
+	// OpenGroupsByName returns the number of open groups by processor name.
+	OpenGroupsByName() map[string]int
+}
+
+// Holder is implemented by the consumer of a Processor to learn when a
+// message is completely processed, including the work that continues after
+// ProcessMessage returns.
+type Holder interface {
+	// Hold defers the completion of the message until release is called.
+	Hold() (release func())
+}
+
+// holderKey is the context key of the Holder.
+type holderKey struct{}
+
+// WithHolder returns a copy of ctx that carries the Holder of the message
+// passed to ProcessMessage with it.
+func WithHolder(ctx context.Context, holder Holder) context.Context {
+	return context.WithValue(ctx, holderKey{}, holder)
+}
+
+// Hold is called by processors that keep a message after ProcessMessage
+// returns, e.g. in a queue or an open group, with the ctx passed to
+// ProcessMessage. The release function must be called once the message has
+// been acted on or dropped. The pipeline only acknowledges a message once it
+// has been released, so that it is read again when the processing is
+// interrupted. It returns a no-op when ctx carries no Holder.
+func Hold(ctx context.Context) (release func()) {
+	holder := HolderFromContext(ctx)
+	if holder == nil {
+		return func() {}
+	}
+
+	return holder.Hold()
+}
+
+// HolderFromContext returns the Holder carried by ctx, or nil when there is
+// none. It is used to pass the Holder on when the message is processed with
+// another context.
+func HolderFromContext(ctx context.Context) Holder {
+	holder, _ := ctx.Value(holderKey{}).(Holder)
+
+	return holder
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"time"
 
 	"github.com/peer-calls/log"
 
@@ -18,6 +19,14 @@ type Reader interface {
 	ReadLogs(context.Context, ReadLogsParams) error
 }
 
+// ChildHeartbeater is implemented by Readers that run pipelines of their own,
+// e.g. one per docker container, to report the liveness of those pipelines.
+type ChildHeartbeater interface {
+	// ChildHeartbeats returns the last time each running child pipeline was
+	// active, by its reader ID.
+	ChildHeartbeats() map[ReaderID]time.Time
+}
+
 // ReaderParams contains common parameters for all Reader implementations.
 type ReaderParams struct {
 	ReaderID ReaderID
@@ -28,6 +37,20 @@ type ReaderParams struct {
 type ReadLogsParams struct {
 	State State          // State for resuming reading.
 	Ch    chan<- Message // Ch is a channel to write the messages to.
+	// Until, when set, is the time of the last message to read. ReadLogs
+	// returns once it has read all messages up to Until instead of waiting
+	// for new ones.
+	Until time.Time
+	// Progress, when set, is called by the readers while they wait for new
+	// messages, to report that they are not stuck. Optional.
+	Progress func()
+}
+
+// ReportProgress calls Progress, when set.
+func (w ReadLogsParams) ReportProgress() {
+	if w.Progress != nil {
+		w.Progress()
+	}
 }
 
 // ReadLogsParams is a convenience wrapper that tries to send to Ch until the
@@ -0,0 +1,12 @@
+package types
+
+import "context"
+
+// Transformer is implemented by processors that modify messages. When used in
+// a chain of processors, the transformed message is passed to all the
+// subsequent processors.
+type Transformer interface {
+	// TransformMessage returns the modified message. Implementations must not
+	// modify the original message's Fields in place.
+	TransformMessage(context.Context, Message) (Message, error)
+}
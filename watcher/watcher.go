@@ -2,23 +2,72 @@ package watcher
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jeremija/taily/clock"
+	"github.com/jeremija/taily/metrics"
 	"github.com/jeremija/taily/types"
 	"github.com/juju/errors"
 	"github.com/peer-calls/log"
 )
 
+// Defaults for Params.
+const (
+	DefaultCheckpointInterval = 10 * time.Second
+	DefaultShutdownGrace      = 10 * time.Second
+)
+
+// Checkpoint configures how often the acknowledged state is persisted while
+// watching.
+type Checkpoint struct {
+	Interval time.Duration // Interval between checkpoints. Defaults to DefaultCheckpointInterval.
+	// Messages is the number of acknowledged messages after which a checkpoint
+	// is made before the Interval has passed. Disabled when zero.
+	Messages int
+}
+
 // Watcher is a component that wraps a Reader and takes care of loading and
 // storing state before an after calling Reader.ReadLogs. It ensures that each
 // Reader never reads the same messages that were previously read.
+//
+// Only the state of acknowledged messages is persisted, so messages which
+// were read but not processed before a crash are read again on restart. The
+// consumer of the channel passed to Watch must call Ack for every message it
+// receives, and Persist once Watch is done and it has finished acting on the
+// acknowledged messages.
 type Watcher struct {
-	params Params
+	params   Params
+	progress int64 // progress is the UnixNano time of the last reader progress.
+
+	mu      sync.Mutex
+	pending []types.State // pending contains states of unacknowledged messages.
+	acked   types.State   // acked is the state of the last acknowledged message.
+	loaded  bool          // loaded is true once Watch has loaded the state.
+	ackCh   chan struct{} // ackCh is signaled on every Ack.
+
+	numAcked     int           // numAcked since the last checkpoint request.
+	checkpointCh chan struct{} // checkpointCh requests a checkpoint.
 }
 
 func New(params Params) *Watcher {
+	if params.Checkpoint.Interval <= 0 {
+		params.Checkpoint.Interval = DefaultCheckpointInterval
+	}
+
+	if params.Clock == nil {
+		params.Clock = clock.New()
+	}
+
+	if params.ShutdownGrace <= 0 {
+		params.ShutdownGrace = DefaultShutdownGrace
+	}
+
 	return &Watcher{
-		params: params,
+		params:       params,
+		ackCh:        make(chan struct{}, 1),
+		checkpointCh: make(chan struct{}, 1),
 	}
 }
 
@@ -28,16 +77,29 @@ type Params struct {
 	Reader       types.Reader    // Reader to read logs from.
 	Logger       log.Logger      // Logger to use.
 	InitialState types.State
+	Checkpoint   Checkpoint  // Checkpoint configures periodic persisting of state.
+	Clock        types.Clock // Clock to use for checkpoints. Defaults to the system clock.
+	// ShutdownGrace is the maximum time Watch waits for the remaining
+	// messages to be acknowledged after the reading is done. The messages
+	// acknowledged later are still persisted by Persist, while the others
+	// are read again on the next start. Defaults to DefaultShutdownGrace.
+	ShutdownGrace time.Duration
+	Metrics       *metrics.Metrics // Metrics to record, optional.
+	// Until, when set, is passed to Reader.ReadLogs so that the reading
+	// completes after the messages up to Until have been read.
+	Until time.Time
 }
 
 // watch calls ReadLogs and prevents duplicate messages from being read.
-func (w *Watcher) watch(ctx context.Context, state types.State, ch chan<- types.Message) (types.State, error) {
+func (w *Watcher) watch(ctx context.Context, state types.State, ch chan<- types.Message) error {
 	localCh := make(chan types.Message)
 	errCh := make(chan error, 1)
 
 	params := types.ReadLogsParams{
-		State: state,
-		Ch:    localCh,
+		State:    state,
+		Ch:       localCh,
+		Until:    w.params.Until,
+		Progress: w.reportProgress,
 	}
 
 	go func() {
@@ -49,10 +111,15 @@ func (w *Watcher) watch(ctx context.Context, state types.State, ch chan<- types.
 	count := 0
 
 	send := func(message types.Message) error {
+		// Add the state before sending so that Ack can never be called first.
+		w.addPending(state)
+
 		select {
 		case ch <- message:
 			return nil
 		case <-ctx.Done():
+			w.removePending()
+
 			return errors.Trace(ctx.Err())
 		}
 	}
@@ -60,6 +127,8 @@ func (w *Watcher) watch(ctx context.Context, state types.State, ch chan<- types.
 	// Ignore old messages.
 	if state.NumMessages > 0 {
 		for message := range localCh {
+			w.reportProgress()
+
 			if message.Timestamp.Equal(state.Timestamp) {
 				count++
 
@@ -71,7 +140,7 @@ func (w *Watcher) watch(ctx context.Context, state types.State, ch chan<- types.
 			state = state.WithTimestamp(message.Timestamp).WithCursor(message.Cursor)
 
 			if err := send(message); err != nil {
-				return state, errors.Trace(err)
+				return errors.Trace(err)
 			}
 
 			break
@@ -79,14 +148,148 @@ func (w *Watcher) watch(ctx context.Context, state types.State, ch chan<- types.
 	}
 
 	for message := range localCh {
+		w.reportProgress()
+
 		state = state.WithTimestamp(message.Timestamp).WithCursor(message.Cursor)
 
 		if err := send(message); err != nil {
-			return state, errors.Trace(err)
+			return errors.Trace(err)
+		}
+	}
+
+	return errors.Trace(<-errCh)
+}
+
+// reportProgress records that the reader has delivered a message or reported
+// that it is waiting for new ones.
+func (w *Watcher) reportProgress() {
+	atomic.StoreInt64(&w.progress, w.params.Clock.Now().UnixNano())
+}
+
+// Progress returns the last time the reader delivered a message or reported
+// that it is waiting for new ones, see types.ReadLogsParams.Progress. It
+// returns the zero time before Watch is called.
+func (w *Watcher) Progress() time.Time {
+	nanos := atomic.LoadInt64(&w.progress)
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
+
+// addPending adds the state of a message about to be sent.
+func (w *Watcher) addPending(state types.State) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, state)
+}
+
+// removePending removes the state of a message that could not be sent.
+func (w *Watcher) removePending() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = w.pending[:len(w.pending)-1]
+}
+
+// Ack acknowledges that the oldest unacknowledged message received from the
+// channel passed to Watch has been processed. Messages must be acknowledged
+// in the order they were received, including the ones that failed to
+// process, otherwise the same messages would be read again indefinitely.
+func (w *Watcher) Ack() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) == 0 {
+		return
+	}
+
+	w.acked = w.pending[0]
+	w.pending = w.pending[1:]
+
+	select {
+	case w.ackCh <- struct{}{}:
+	default:
+	}
+
+	if w.params.Checkpoint.Messages <= 0 {
+		return
+	}
+
+	w.numAcked++
+
+	if w.numAcked >= w.params.Checkpoint.Messages {
+		w.numAcked = 0
+
+		// Do not block, the state is saved in a separate goroutine.
+		select {
+		case w.checkpointCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ackedState returns the state of the last acknowledged message.
+func (w *Watcher) ackedState() types.State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.acked
+}
+
+// waitAcked waits until all sent messages have been acknowledged, or until
+// ShutdownGrace has passed. The wait is bounded even when ctx is not done,
+// since a processor might hold messages it never releases, e.g. when its
+// state cannot be saved.
+func (w *Watcher) waitAcked() {
+	timer := time.NewTimer(w.params.ShutdownGrace)
+	defer timer.Stop()
+
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		w.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		select {
+		case <-w.ackCh:
+		case <-timer.C:
+			w.params.Logger.Warn("Shutdown grace period expired, unacknowledged messages", log.Ctx{
+				"unacknowledged": n,
+			})
+
+			return
 		}
 	}
+}
+
+// checkpoint persists the acknowledged state periodically or when requested
+// via checkpointCh, until ctx is done.
+func (w *Watcher) checkpoint(ctx context.Context, saved types.State) {
+	ticker := w.params.Clock.NewTicker(w.params.Checkpoint.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+		case <-w.checkpointCh:
+			// Start a new interval after a forced save.
+			ticker.Reset(w.params.Checkpoint.Interval)
+		case <-ctx.Done():
+			return
+		}
+
+		if state := w.ackedState(); state != saved {
+			w.persistState(state)
 
-	return state, errors.Trace(<-errCh)
+			saved = state
+		}
+	}
 }
 
 // persistState persists the Reader's state. It uses a separate context so that
@@ -103,30 +306,39 @@ func (w *Watcher) persistState(state types.State) {
 		"state":     state.String(),
 	})
 
-	// TODO perhaps it would be wiser to call SaveState only after we've
-	// successfully processed the message. On the other hand, failure to
-	// process could hang the processing indefinitely in case we reached a part
-	// that we cannot process
-	if err := w.params.Persister.SaveState(ctx, readerID, state); err != nil {
+	err := w.params.Persister.SaveState(ctx, readerID, state)
+	if err != nil {
 		logger.Error("Saving state", err, nil)
 	} else {
 		logger.Info("Saved state", nil)
 	}
+
+	w.params.Metrics.StateSaved(readerID, err)
 }
 
-// Watch loads the state and invokes the Reader.ReadLogs. It persists the state
-// after the reading is done. The ch will be closed after reading is complete.
+// Watch loads the state and invokes the Reader.ReadLogs. It persists the
+// acknowledged state periodically, while the final state is persisted by
+// Persist. The ch will be closed after reading is complete, after which Watch
+// waits for the remaining messages to be acknowledged, for at most
+// ShutdownGrace.
 func (w *Watcher) Watch(ctx context.Context, ch chan<- types.Message) (err error) {
-	defer close(ch)
-
 	readerID := w.params.Reader.ReaderID()
 	logger := w.params.Logger
 
 	logger.Info("Watch daemon STARTED", nil)
 	defer logger.Info("Watch daemon DONE", nil)
 
+	w.mu.Lock()
+	w.loaded = false
+	w.mu.Unlock()
+
+	// The reader has not delivered anything yet, but it has just started.
+	w.reportProgress()
+
 	state, err := w.params.Persister.LoadState(ctx, readerID)
 	if err != nil {
+		close(ch)
+
 		return errors.Trace(err)
 	}
 
@@ -139,15 +351,48 @@ func (w *Watcher) Watch(ctx context.Context, ch chan<- types.Message) (err error
 		"state":     state.String(),
 	})
 
-	// Persist state at the end, regardless if we encountered an error or not.
+	w.mu.Lock()
+	w.pending = nil
+	w.acked = state
+	w.loaded = true
+	w.numAcked = 0
+	w.mu.Unlock()
 
-	state, err = w.watch(ctx, state, ch)
+	checkpointCtx, cancel := context.WithCancel(context.Background())
+	checkpointDone := make(chan struct{})
 
-	w.persistState(state)
+	go func() {
+		defer close(checkpointDone)
+
+		w.checkpoint(checkpointCtx, state)
+	}()
+
+	err = w.watch(ctx, state, ch)
+
+	close(ch)
+
+	w.waitAcked()
+
+	cancel()
+	<-checkpointDone
 
 	return errors.Trace(err)
 }
 
+// Persist persists the acknowledged state after Watch is done, regardless if
+// it encountered an error or not. The consumer calls it once the acknowledged
+// messages have been flushed, so that they are not lost when it is
+// interrupted before. It does nothing when Watch failed to load the state.
+func (w *Watcher) Persist() {
+	w.mu.Lock()
+	state, loaded := w.acked, w.loaded
+	w.mu.Unlock()
+
+	if loaded {
+		w.persistState(state)
+	}
+}
+
 // WatchAsync calls Watch in a separate goroutine and returns a channel that
 // will return an error upon completion. The resulting channel is buffered so
 // it does not need to be read from.
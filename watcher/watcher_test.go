@@ -0,0 +1,348 @@
+package watcher_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jeremija/taily/mock"
+	"github.com/jeremija/taily/persister"
+	"github.com/jeremija/taily/types"
+	"github.com/jeremija/taily/watcher"
+	"github.com/peer-calls/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_Ack(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := persister.NewFile(t.TempDir())
+	reader := mock.NewReader("test")
+
+	w := watcher.New(watcher.Params{
+		Persister: p,
+		Reader:    reader,
+		Logger:    log.New(),
+	})
+
+	ch := make(chan types.Message)
+	errCh := w.WatchAsync(ctx, ch)
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	ts1 := time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)
+	ts2 := time.Date(2022, 1, 1, 0, 0, 2, 0, time.UTC)
+
+	go func() {
+		defer readCtx.Close()
+
+		for _, ts := range []time.Time{ts1, ts2} {
+			message := types.NewMessage(ts, "test", "hello", nil)
+			message.Cursor = ts.String()
+
+			if err := readCtx.MockMessage(ctx, message); err != nil {
+				return
+			}
+		}
+	}()
+
+	message := <-ch
+	assert.Equal(t, ts1, message.Timestamp)
+	w.Ack()
+
+	message = <-ch
+	assert.Equal(t, ts2, message.Timestamp)
+
+	_, ok := <-ch
+	assert.False(t, ok, "channel should be closed")
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("watch returned before last message was acknowledged: %+v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Ack()
+
+	require.NoError(t, <-errCh)
+
+	// The final state is only persisted once the consumer has flushed.
+	state, err := p.LoadState(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, types.State{}, state)
+
+	w.Persist()
+
+	state, err = p.LoadState(ctx, "test")
+	require.NoError(t, err)
+
+	assert.Equal(t, types.State{
+		Timestamp:   ts2,
+		NumMessages: 1,
+		Cursor:      ts2.String(),
+	}, state)
+}
+
+func TestWatcher_Checkpoint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := persister.NewFile(t.TempDir())
+	reader := mock.NewReader("test")
+
+	w := watcher.New(watcher.Params{
+		Persister: p,
+		Reader:    reader,
+		Logger:    log.New(),
+		Checkpoint: watcher.Checkpoint{
+			Interval: time.Hour,
+			Messages: 2,
+		},
+	})
+
+	ch := make(chan types.Message)
+	errCh := w.WatchAsync(ctx, ch)
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	defer readCtx.Close()
+
+	ts := time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)
+
+	loadState := func() types.State {
+		state, err := p.LoadState(ctx, "test")
+		require.NoError(t, err)
+
+		return state
+	}
+
+	for i := 0; i < 3; i++ {
+		go func() {
+			_ = readCtx.MockMessage(ctx, types.NewMessage(ts, "test", "hello", nil))
+		}()
+
+		<-ch
+		w.Ack()
+
+		if i == 0 {
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, types.State{}, loadState(), "checkpoint too early")
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return loadState().NumMessages >= 2
+	}, time.Second, 10*time.Millisecond)
+
+	readCtx.Close()
+	require.NoError(t, <-errCh)
+
+	w.Persist()
+
+	assert.Equal(t, types.State{Timestamp: ts, NumMessages: 3}, loadState())
+}
+
+func TestWatcher_CheckpointReset(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := persister.NewFile(t.TempDir())
+	reader := mock.NewReader("test")
+	clock := mock.NewClock(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	w := watcher.New(watcher.Params{
+		Persister: p,
+		Reader:    reader,
+		Logger:    log.New(),
+		Clock:     clock,
+		Checkpoint: watcher.Checkpoint{
+			Interval: time.Minute,
+			Messages: 2,
+		},
+	})
+
+	ch := make(chan types.Message)
+	errCh := w.WatchAsync(ctx, ch)
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	defer readCtx.Close()
+
+	ts := time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)
+
+	loadState := func() types.State {
+		state, err := p.LoadState(ctx, "test")
+		require.NoError(t, err)
+
+		return state
+	}
+
+	read := func() {
+		go func() {
+			_ = readCtx.MockMessage(ctx, types.NewMessage(ts, "test", "hello", nil))
+		}()
+
+		<-ch
+		w.Ack()
+	}
+
+	waitSaved := func(numMessages int, msg string) {
+		assert.Eventually(t, func() bool {
+			return loadState().NumMessages == numMessages
+		}, time.Second, 10*time.Millisecond, msg)
+	}
+
+	// The first forced checkpoint also ensures that the ticker is running.
+	read()
+	read()
+	waitSaved(2, "first forced checkpoint")
+
+	clock.Add(40 * time.Second)
+
+	read()
+	read()
+	waitSaved(4, "second forced checkpoint")
+
+	read()
+
+	// The periodic checkpoint was due at 1m before the second forced one.
+	clock.Add(30 * time.Second)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 4, loadState().NumMessages, "checkpoint too early")
+
+	clock.Add(30 * time.Second)
+	waitSaved(5, "periodic checkpoint")
+
+	readCtx.Close()
+	require.NoError(t, <-errCh)
+}
+
+func TestWatcher_Until(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	since := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(time.Hour)
+
+	reader := mock.NewReader("test")
+
+	w := watcher.New(watcher.Params{
+		Persister:    persister.NewNoop(),
+		Reader:       reader,
+		Logger:       log.New(),
+		InitialState: types.State{Timestamp: since},
+		Until:        until,
+	})
+
+	ch := make(chan types.Message)
+	errCh := w.WatchAsync(ctx, ch)
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, since, readCtx.Params().State.Timestamp)
+	assert.Equal(t, until, readCtx.Params().Until)
+
+	readCtx.Close()
+
+	_, ok := <-ch
+	assert.False(t, ok, "channel should be closed")
+
+	require.NoError(t, <-errCh)
+}
+
+func TestWatcher_ShutdownGrace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := persister.NewFile(t.TempDir())
+	reader := mock.NewReader("test")
+
+	w := watcher.New(watcher.Params{
+		Persister:     p,
+		Reader:        reader,
+		Logger:        log.New(),
+		ShutdownGrace: 50 * time.Millisecond,
+	})
+
+	ch := make(chan types.Message)
+	errCh := w.WatchAsync(ctx, ch)
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	go func() {
+		defer readCtx.Close()
+
+		_ = readCtx.MockMessage(ctx, types.NewMessage(time.Now(), "test", "hello", nil))
+	}()
+
+	<-ch
+
+	_, ok := <-ch
+	assert.False(t, ok, "channel should be closed")
+
+	// The reading has completed without ctx being done, but the message is
+	// never acknowledged.
+	require.NoError(t, <-errCh)
+
+	w.Persist()
+
+	state, err := p.LoadState(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, types.State{}, state, "unacknowledged message should be read again")
+}
+
+func TestWatcher_Progress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := mock.NewClock(start)
+	reader := mock.NewReader("test")
+
+	w := watcher.New(watcher.Params{
+		Persister: persister.NewNoop(),
+		Reader:    reader,
+		Logger:    log.New(),
+		Clock:     clock,
+	})
+
+	assert.True(t, w.Progress().IsZero())
+
+	ch := make(chan types.Message)
+	errCh := w.WatchAsync(ctx, ch)
+
+	readCtx, err := reader.Accept(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, start, w.Progress().UTC(), "progress should be reported upon start")
+
+	// The reader reports progress while waiting.
+	clock.Add(time.Minute)
+	readCtx.Params().ReportProgress()
+	assert.Equal(t, start.Add(time.Minute), w.Progress().UTC())
+
+	// And with every message.
+	clock.Add(time.Minute)
+
+	go func() {
+		_ = readCtx.MockMessage(ctx, types.NewMessage(clock.Now(), "test", "hello", nil))
+	}()
+
+	<-ch
+	assert.Equal(t, start.Add(2*time.Minute), w.Progress().UTC())
+	w.Ack()
+
+	readCtx.Close()
+
+	_, ok := <-ch
+	assert.False(t, ok, "channel should be closed")
+
+	require.NoError(t, <-errCh)
+}